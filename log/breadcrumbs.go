@@ -0,0 +1,114 @@
+package log
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/getsentry/raven-go"
+	"go.uber.org/zap/zapcore"
+)
+
+// Breadcrumb is a log entry leading up to a sentry event
+type Breadcrumb struct {
+	Timestamp float64                `json:"timestamp"`
+	Type      string                 `json:"type"`
+	Category  string                 `json:"category,omitempty"`
+	Level     raven.Severity         `json:"level"`
+	Message   string                 `json:"message"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// Breadcrumbs implements raven.Interface to attach breadcrumbs to a packet
+type Breadcrumbs struct {
+	Values []*Breadcrumb `json:"values"`
+}
+
+// Class implements raven.Interface
+func (b *Breadcrumbs) Class() string { return "breadcrumbs" }
+
+func newBreadcrumb(ent zapcore.Entry, coreFields, fields []zapcore.Field) *Breadcrumb {
+	crumb := &Breadcrumb{
+		Timestamp: float64(ent.Time.UnixNano()) / float64(time.Second),
+		Type:      "default",
+		Category:  ent.LoggerName,
+		Level:     zapLevelToRavenSeverity[ent.Level],
+		Message:   ent.Message,
+	}
+	if len(coreFields)+len(fields) > 0 {
+		encoder := zapcore.NewMapObjectEncoder()
+		for _, field := range coreFields {
+			field.AddTo(encoder)
+		}
+		for _, field := range fields {
+			field.AddTo(encoder)
+		}
+		if len(encoder.Fields) > 0 {
+			crumb.Data = encoder.Fields
+		}
+	}
+	return crumb
+}
+
+// breadcrumbBuffer is a bounded ring buffer of the most recent breadcrumbs
+type breadcrumbBuffer struct {
+	mu     sync.Mutex
+	crumbs []*Breadcrumb
+	next   int
+	full   bool
+}
+
+func newBreadcrumbBuffer(limit int) *breadcrumbBuffer {
+	return &breadcrumbBuffer{crumbs: make([]*Breadcrumb, limit)}
+}
+
+func (b *breadcrumbBuffer) add(crumb *Breadcrumb) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.crumbs) == 0 {
+		return
+	}
+	b.crumbs[b.next] = crumb
+	b.next = (b.next + 1) % len(b.crumbs)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// flush returns all breadcrumbs, oldest first, and empties the buffer
+func (b *breadcrumbBuffer) flush() []*Breadcrumb {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var crumbs []*Breadcrumb
+	if b.full {
+		crumbs = append(crumbs, b.crumbs[b.next:]...)
+	}
+	crumbs = append(crumbs, b.crumbs[:b.next]...)
+
+	for i := range b.crumbs {
+		b.crumbs[i] = nil
+	}
+	b.next, b.full = 0, false
+	return crumbs
+}
+
+// WithBreadcrumbs returns a context whose logger records entries below the sentry level
+// The recorded entries are attached as breadcrumbs to the next sentry event reported through this context
+func WithBreadcrumbs(ctx context.Context) context.Context {
+	return WithLogger(ctx, From(ctx).WithBreadcrumbs())
+}
+
+// WithBreadcrumbs returns a new logger with its own breadcrumb buffer
+// Entries below the sentry level are recorded and attached to the next event reported by the returned logger
+// or any logger derived from it. Without sentry the logger is returned unchanged
+func (l *Logger) WithBreadcrumbs() *Logger {
+	if l.nop || l.Reporter == nil {
+		return l
+	}
+	crumbs := newBreadcrumbBuffer(l.breadcrumbLimit)
+	return l.withSentry(func(s *sentryCore) *sentryCore {
+		return s.withBreadcrumbs(crumbs)
+	})
+}
@@ -0,0 +1,207 @@
+package log
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/getsentry/raven-go"
+	"github.com/pkg/errors"
+	"go.uber.org/atomic"
+	"go.uber.org/multierr"
+)
+
+// SentryStats counts the events handed to the sentry client
+type SentryStats struct {
+	// Captured events passed to the ErrorReporter or dropped after Close
+	Captured int64
+	// Sent events accepted by sentry
+	Sent int64
+	// Failed events rejected by sentry or failing to be transmitted
+	Failed int64
+	// Dropped events due to a full queue or being reported after Close
+	Dropped int64
+	// Sampled events not reported due to the sample rate
+	Sampled int64
+	// Suppressed events not reported due to the rate limit
+	Suppressed int64
+	// Filtered events dropped by the BeforeSend hook
+	Filtered int64
+	// Spooled events stored on disk to be sent later
+	Spooled int64
+}
+
+// Pending returns the number of captured events not yet sent, spooled, failed or dropped
+func (s SentryStats) Pending() int64 {
+	return s.Captured - s.Sent - s.Spooled - s.Failed - s.Dropped
+}
+
+// sentryState is shared by all cores reporting to the same ErrorReporter
+type sentryState struct {
+	reporter ErrorReporter
+
+	// mu guards capturing against closing the reporter
+	mu     sync.RWMutex
+	closed bool
+
+	limiter    *sentryLimiter
+	beforeSend BeforeSend
+
+	captured   atomic.Int64
+	sent       atomic.Int64
+	failed     atomic.Int64
+	dropped    atomic.Int64
+	sampled    atomic.Int64
+	suppressed atomic.Int64
+	filtered   atomic.Int64
+	spooled    atomic.Int64
+}
+
+func newSentryState(reporter ErrorReporter, limiter *sentryLimiter, beforeSend BeforeSend) *sentryState {
+	return &sentryState{reporter: reporter, limiter: limiter, beforeSend: beforeSend}
+}
+
+// capture passes packet to the reporter unless the state is closed or the BeforeSend hook drops it
+// The returned channel receives the result of sending the packet
+func (s *sentryState) capture(packet *raven.Packet) (chan error, bool) {
+	// the hook is called without holding the lock, so it is able to log itself
+	if s.beforeSend != nil {
+		if packet = s.beforeSend(packet); packet == nil {
+			s.filtered.Inc()
+			return nil, false
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	s.captured.Inc()
+	if s.closed {
+		s.dropped.Inc()
+		return nil, false
+	}
+	errCh := make(chan error, 1)
+	s.reporter.Capture(packet, func(err error) {
+		s.count(err)
+		errCh <- err
+	})
+	return errCh, true
+}
+
+// count the result of sending an event
+func (s *sentryState) count(err error) {
+	switch err {
+	case nil:
+		s.sent.Inc()
+	case errSpooled:
+		s.spooled.Inc()
+	case ErrEventDropped:
+		s.dropped.Inc()
+	default:
+		s.failed.Inc()
+	}
+}
+
+// close marks the state as closed, returning false if it already was
+func (s *sentryState) close() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.closed = true
+	return true
+}
+
+func (s *sentryState) isClosed() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.closed
+}
+
+func (s *sentryState) stats() SentryStats {
+	return SentryStats{
+		Captured:   s.captured.Load(),
+		Sent:       s.sent.Load(),
+		Failed:     s.failed.Load(),
+		Dropped:    s.dropped.Load(),
+		Sampled:    s.sampled.Load(),
+		Suppressed: s.suppressed.Load(),
+		Filtered:   s.filtered.Load(),
+		Spooled:    s.spooled.Load(),
+	}
+}
+
+// SentryStats returns the counts of events reported by the logger and all loggers sharing its ErrorReporter
+func (l *Logger) SentryStats() SentryStats {
+	if l.sentryState == nil {
+		return SentryStats{}
+	}
+	return l.sentryState.stats()
+}
+
+// Close syncs all sinks, flushes the sentry queue and closes the ErrorReporter, spool and log file
+// Flushing is aborted when ctx is done. An error is returned if events got lost, reporting how many.
+// Close affects all loggers sharing the sinks, entries reported to sentry afterwards are dropped
+func (l *Logger) Close(ctx context.Context) error {
+	if l.nop {
+		return nil
+	}
+
+	var err error
+	if l.sentryState != nil {
+		if l.sentryState.isClosed() {
+			return nil
+		}
+		// report the suppressed events of all open windows before the client is closed
+		l.sentryState.limiter.flush()
+		if !l.sentryState.close() {
+			return nil
+		}
+	}
+
+	synced := make(chan error, 1)
+	go func() {
+		synced <- l.Logger.Sync()
+	}()
+	select {
+	case syncErr := <-synced:
+		err = multierr.Append(err, ignoreSyncErrors(syncErr))
+	case <-ctx.Done():
+		err = multierr.Append(err, errors.Wrap(ctx.Err(), "syncing"))
+	}
+
+	if l.Reporter != nil {
+		// the sentry core skips flushing once closed, so the queue is flushed here
+		if flushErr := l.Reporter.Flush(ctx); flushErr != nil {
+			err = multierr.Append(err, errors.Wrap(flushErr, "flushing sentry"))
+		}
+		err = multierr.Append(err, l.Reporter.Close())
+		stats := l.sentryState.stats()
+		if lost := stats.Failed + stats.Dropped + stats.Pending(); lost > 0 {
+			err = multierr.Append(err, errors.Errorf("%d of %d sentry events dropped", lost, stats.Captured))
+		}
+	}
+
+	if l.spool != nil {
+		l.spool.Close()
+	}
+
+	if l.File != nil {
+		err = multierr.Append(err, l.File.Close())
+	}
+	return err
+}
+
+// ignoreSyncErrors removes the errors returned when syncing stdout or stderr if they are a terminal or pipe
+func ignoreSyncErrors(err error) error {
+	var errs error
+	for _, e := range multierr.Errors(err) {
+		if pathErr, ok := e.(*os.PathError); ok && isUnsyncable(pathErr.Err) {
+			continue
+		}
+		errs = multierr.Append(errs, e)
+	}
+	return errs
+}
@@ -0,0 +1,13 @@
+//go:build !plan9
+// +build !plan9
+
+package log
+
+import (
+	"syscall"
+)
+
+// isUnsyncable returns true if err is returned for syncing a file which does not support it, like a terminal or pipe
+func isUnsyncable(err error) bool {
+	return err == syscall.EINVAL || err == syscall.ENOTTY
+}
@@ -0,0 +1,7 @@
+package log
+
+// isUnsyncable returns true if err is returned for syncing a file which does not support it
+// Plan 9 reports no dedicated error for this, so nothing is being ignored
+func isUnsyncable(err error) bool {
+	return false
+}
@@ -0,0 +1,119 @@
+package log_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seibert-media/golibs/log"
+	"github.com/seibert-media/golibs/logtest/sentrytest"
+)
+
+func Test_Close(t *testing.T) {
+	server := sentrytest.NewServer()
+	defer server.Close()
+
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	logger, err := log.NewWithOptions(
+		log.OptLocal(true),
+		log.OptOutput(ioutil.Discard),
+		log.OptSentryDSN(server.DSN()),
+		log.OptFile(log.FileConfig{Path: filepath.Join(dir, "app.log")}),
+	)
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+
+	logger.Error("first")
+	logger.Error("second")
+	if err := logger.Close(context.Background()); err != nil {
+		t.Fatal("closing failed with:", err)
+	}
+	if len(server.Events()) != 2 {
+		t.Fatal("all events should be flushed, got:", len(server.Events()))
+	}
+	if stats := logger.SentryStats(); stats.Captured != 2 || stats.Sent != 2 || stats.Pending() != 0 {
+		t.Fatal("unexpected stats:", stats)
+	}
+	if _, err := logger.File.Write([]byte("test")); err == nil {
+		t.Fatal("file should be closed")
+	}
+
+	logger.Error("after close")
+	if stats := logger.SentryStats(); stats.Dropped != 1 {
+		t.Fatal("events after close should be dropped, got:", stats)
+	}
+	if err := logger.Close(context.Background()); err != nil {
+		t.Fatal("closing twice should be a no-op, got:", err)
+	}
+}
+
+func Test_CloseTimeout(t *testing.T) {
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer server.Close()
+	defer close(block)
+
+	logger, err := log.NewWithOptions(
+		log.OptLocal(true),
+		log.OptOutput(ioutil.Discard),
+		log.OptSentryDSN(strings.Replace(server.URL, "://", "://public@", 1)+"/1"),
+	)
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+	logger.Error("hanging")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = logger.Close(ctx)
+	if time.Since(start) > time.Second {
+		t.Fatal("closing should respect the context deadline")
+	}
+	if err == nil || !strings.Contains(err.Error(), "1 of 1 sentry events dropped") {
+		t.Fatal("dropped events should be reported, got:", err)
+	}
+}
+
+func Test_CloseFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	logger, _ := log.NewWithOptions(
+		log.OptLocal(true),
+		log.OptOutput(ioutil.Discard),
+		log.OptSentryDSN(strings.Replace(server.URL, "://", "://public@", 1)+"/1"),
+	)
+	logger.Error("rejected")
+	err := logger.Close(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "1 of 1 sentry events dropped") {
+		t.Fatal("failed events should be reported, got:", err)
+	}
+	if stats := logger.SentryStats(); stats.Failed != 1 {
+		t.Fatal("unexpected stats:", stats)
+	}
+}
+
+func Test_CloseWithoutSentry(t *testing.T) {
+	logger, _ := log.NewWithOptions(log.OptLocal(true), log.OptOutput(ioutil.Discard))
+	if err := logger.Close(context.Background()); err != nil {
+		t.Fatal("closing failed with:", err)
+	}
+	if err := log.NewNop().Close(context.Background()); err != nil {
+		t.Fatal("closing nop logger failed with:", err)
+	}
+	if (log.SentryStats{Captured: 3, Sent: 1, Dropped: 1}).Pending() != 1 {
+		t.Fatal("pending events miscounted")
+	}
+}
@@ -0,0 +1,279 @@
+package log
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Config holds all settings a Logger can be built from
+type Config struct {
+	Level             zapcore.Level
+	Levels            LevelSpec
+	Local             bool
+	SentryDSN         string
+	SentryEnvironment string
+	SentryLevel       zapcore.Level
+	SentryProtocol    SentryProtocol
+	SentrySampleRate  float64
+	SentryRateLimit   int
+	SentryRateWindow  time.Duration
+	SentrySpool       SpoolConfig
+	Release           string
+	ErrorReporting    string
+	File              FileConfig
+	FileLevel         zapcore.Level
+}
+
+// Environment variable suffixes read by ConfigFromEnv, each prefixed with "<PREFIX>_"
+const (
+	EnvLogLevel          = "LOG_LEVEL"
+	EnvLogLevels         = "LOG_LEVELS"
+	EnvLogLocal          = "LOG_LOCAL"
+	EnvSentryDSN         = "SENTRY_DSN"
+	EnvSentryEnvironment = "SENTRY_ENVIRONMENT"
+	EnvSentryLevel       = "SENTRY_LEVEL"
+	EnvSentryProtocol    = "SENTRY_PROTOCOL"
+	EnvSentrySampleRate  = "SENTRY_SAMPLE_RATE"
+	EnvSentryRateLimit   = "SENTRY_RATE_LIMIT"
+	EnvSentryRateWindow  = "SENTRY_RATE_WINDOW"
+	EnvSentrySpool       = "SENTRY_SPOOL"
+	EnvSentrySpoolSize   = "SENTRY_SPOOL_MAX_SIZE"
+	EnvRelease           = "RELEASE"
+	EnvErrorReporting    = "ERROR_REPORTING_SERVICE"
+	EnvLogFile           = "LOG_FILE"
+	EnvLogFileFormat     = "LOG_FILE_FORMAT"
+	EnvLogFileMaxSize    = "LOG_FILE_MAX_SIZE"
+	EnvLogFileMaxAge     = "LOG_FILE_MAX_AGE"
+	EnvLogFileMaxBackups = "LOG_FILE_MAX_BACKUPS"
+	EnvLogFileCompress   = "LOG_FILE_COMPRESS"
+	EnvLogFileReopen     = "LOG_FILE_REOPEN"
+	EnvLogFileLevel      = "LOG_FILE_LEVEL"
+)
+
+// Flag names registered by RegisterFlags
+const (
+	FlagLogLevel          = "log-level"
+	FlagLogLevels         = "log-levels"
+	FlagLogLocal          = "log-local"
+	FlagSentryDSN         = "sentry-dsn"
+	FlagSentryEnv         = "sentry-env"
+	FlagSentryLevel       = "sentry-level"
+	FlagSentryProtocol    = "sentry-protocol"
+	FlagSentrySampleRate  = "sentry-sample-rate"
+	FlagSentryRateLimit   = "sentry-rate-limit"
+	FlagSentryRateWindow  = "sentry-rate-window"
+	FlagSentrySpool       = "sentry-spool"
+	FlagSentrySpoolSize   = "sentry-spool-max-size"
+	FlagRelease           = "release"
+	FlagErrorReporting    = "error-reporting-service"
+	FlagLogFile           = "log-file"
+	FlagLogFileFormat     = "log-file-format"
+	FlagLogFileMaxSize    = "log-file-max-size"
+	FlagLogFileMaxAge     = "log-file-max-age"
+	FlagLogFileMaxBackups = "log-file-max-backups"
+	FlagLogFileCompress   = "log-file-compress"
+	FlagLogFileReopen     = "log-file-reopen"
+	FlagLogFileLevel      = "log-file-level"
+)
+
+// configVars maps the registered flags to their environment variables
+var configVars = []struct {
+	flag, env string
+}{
+	{FlagLogLevel, EnvLogLevel},
+	{FlagLogLevels, EnvLogLevels},
+	{FlagLogLocal, EnvLogLocal},
+	{FlagSentryDSN, EnvSentryDSN},
+	{FlagSentryEnv, EnvSentryEnvironment},
+	{FlagSentryLevel, EnvSentryLevel},
+	{FlagSentryProtocol, EnvSentryProtocol},
+	{FlagSentrySampleRate, EnvSentrySampleRate},
+	{FlagSentryRateLimit, EnvSentryRateLimit},
+	{FlagSentryRateWindow, EnvSentryRateWindow},
+	{FlagSentrySpool, EnvSentrySpool},
+	{FlagSentrySpoolSize, EnvSentrySpoolSize},
+	{FlagRelease, EnvRelease},
+	{FlagErrorReporting, EnvErrorReporting},
+	{FlagLogFile, EnvLogFile},
+	{FlagLogFileFormat, EnvLogFileFormat},
+	{FlagLogFileMaxSize, EnvLogFileMaxSize},
+	{FlagLogFileMaxAge, EnvLogFileMaxAge},
+	{FlagLogFileMaxBackups, EnvLogFileMaxBackups},
+	{FlagLogFileCompress, EnvLogFileCompress},
+	{FlagLogFileReopen, EnvLogFileReopen},
+	{FlagLogFileLevel, EnvLogFileLevel},
+}
+
+// NewFromEnv builds a Logger from the environment variables starting with prefix
+// See ConfigFromEnv for the variables being read
+func NewFromEnv(prefix string) (*Logger, error) {
+	config, err := ConfigFromEnv(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return config.Build()
+}
+
+// ConfigFromEnv reads the Config from <PREFIX>_LOG_LEVEL, <PREFIX>_LOG_LEVELS, <PREFIX>_LOG_LOCAL, <PREFIX>_SENTRY_DSN,
+// <PREFIX>_SENTRY_ENVIRONMENT, <PREFIX>_SENTRY_LEVEL, <PREFIX>_SENTRY_PROTOCOL, <PREFIX>_SENTRY_SAMPLE_RATE, <PREFIX>_SENTRY_RATE_LIMIT,
+// <PREFIX>_SENTRY_RATE_WINDOW, <PREFIX>_SENTRY_SPOOL, <PREFIX>_SENTRY_SPOOL_MAX_SIZE, <PREFIX>_RELEASE, <PREFIX>_ERROR_REPORTING_SERVICE
+// and the <PREFIX>_LOG_FILE* variables
+// Unset variables keep their default, invalid values return an error naming the variable
+func ConfigFromEnv(prefix string) (*Config, error) {
+	fs := flag.NewFlagSet(prefix, flag.ContinueOnError)
+	config := RegisterFlags(fs)
+
+	for _, v := range configVars {
+		value, ok := lookupEnv(prefix, v.env)
+		if !ok {
+			continue
+		}
+		if err := fs.Set(v.flag, value); err != nil {
+			return nil, errors.Wrapf(err, "parsing %s", envKey(prefix, v.env))
+		}
+	}
+
+	if len(config.SentryDSN) > 0 {
+		if err := validateDSN(config.SentryDSN); err != nil {
+			return nil, errors.Wrapf(err, "parsing %s", envKey(prefix, EnvSentryDSN))
+		}
+	}
+	if !validSampleRate(config.SentrySampleRate) {
+		return nil, errors.Errorf("parsing %s: %v is not between 0 and 1", envKey(prefix, EnvSentrySampleRate), config.SentrySampleRate)
+	}
+
+	return config, nil
+}
+
+// RegisterFlags adds the logger flags to fs and returns the Config they are parsed into
+// The Config can be built after fs.Parse has been called
+func RegisterFlags(fs *flag.FlagSet) *Config {
+	config := &Config{
+		Level:            zapcore.InfoLevel,
+		Levels:           LevelSpec{},
+		SentryLevel:      zapcore.ErrorLevel,
+		SentryProtocol:   SentryProtocolStore,
+		SentrySampleRate: 1,
+		SentryRateWindow: time.Minute,
+		File:             FileConfig{Format: FileFormatJSON},
+		FileLevel:        zapcore.InfoLevel,
+	}
+	fs.Var(&config.Level, FlagLogLevel, "minimum log level (debug, info, warn, error, dpanic, panic, fatal)")
+	fs.Var(&config.Levels, FlagLogLevels, "levels per logger name (e.g. db=debug,http=warn,*=info)")
+	fs.BoolVar(&config.Local, FlagLogLocal, false, "print human readable logs instead of stackdriver json")
+	fs.StringVar(&config.SentryDSN, FlagSentryDSN, "", "sentry dsn to report errors to")
+	fs.StringVar(&config.SentryEnvironment, FlagSentryEnv, "", "environment reported to sentry")
+	fs.Var(&config.SentryLevel, FlagSentryLevel, "minimum level reported to sentry")
+	fs.Var(&config.SentryProtocol, FlagSentryProtocol, "protocol used to report to sentry (store, envelope)")
+	fs.Float64Var(&config.SentrySampleRate, FlagSentrySampleRate, 1, "share of events reported to sentry (0-1)")
+	fs.IntVar(&config.SentryRateLimit, FlagSentryRateLimit, 0, "maximum similar events reported to sentry per window (0 disables the limit)")
+	fs.DurationVar(&config.SentryRateWindow, FlagSentryRateWindow, time.Minute, "window of the sentry rate limit")
+	fs.StringVar(&config.SentrySpool.Dir, FlagSentrySpool, "", "store sentry events failing to be sent in this directory")
+	fs.Int64Var(&config.SentrySpool.MaxBytes, FlagSentrySpoolSize, DefaultSpoolMaxBytes, "maximum bytes of stored sentry events")
+	fs.StringVar(&config.Release, FlagRelease, "", "release reported to sentry")
+	fs.StringVar(&config.ErrorReporting, FlagErrorReporting, "", "service name reported to stackdriver error reporting")
+	fs.StringVar(&config.File.Path, FlagLogFile, "", "additionally write logs to this file")
+	fs.Var(&config.File.Format, FlagLogFileFormat, "format of the log file (json, console)")
+	fs.Int64Var(&config.File.MaxSize, FlagLogFileMaxSize, 0, "rotate the log file after this many bytes")
+	fs.DurationVar(&config.File.MaxAge, FlagLogFileMaxAge, 0, "rotate the log file after this duration")
+	fs.IntVar(&config.File.MaxBackups, FlagLogFileMaxBackups, 0, "number of rotated log files to keep (0 keeps all)")
+	fs.BoolVar(&config.File.Compress, FlagLogFileCompress, false, "compress rotated log files using gzip")
+	fs.BoolVar(&config.File.ReopenOnSIGHUP, FlagLogFileReopen, false, "reopen the log file on SIGHUP")
+	fs.Var(&config.FileLevel, FlagLogFileLevel, "minimum level written to the log file")
+	return config
+}
+
+// Options returns the Options representing the Config for use with NewWithOptions
+func (c *Config) Options() []Option {
+	opts := []Option{
+		OptSentryDSN(c.SentryDSN),
+		OptLocal(c.Local),
+		OptAtomicLevel(zap.NewAtomicLevelAt(c.Level)),
+		OptLevelSpec(c.Levels),
+		OptSentryEnvironment(c.SentryEnvironment),
+		OptSentryLevel(c.SentryLevel),
+		OptSentryProtocol(c.SentryProtocol),
+		OptSentrySampleRate(c.SentrySampleRate),
+		OptSentryRateLimit(c.SentryRateLimit, c.SentryRateWindow),
+		OptRelease(c.Release),
+		OptErrorReporting(c.ErrorReporting),
+	}
+	if len(c.SentrySpool.Dir) > 0 {
+		opts = append(opts, OptSentrySpool(c.SentrySpool))
+	}
+	if len(c.File.Path) > 0 {
+		opts = append(opts,
+			OptFile(c.File),
+			OptSinkLevel(SinkFile, zap.NewAtomicLevelAt(c.FileLevel)),
+		)
+	}
+	return opts
+}
+
+// Build a Logger from the Config
+func (c *Config) Build() (*Logger, error) {
+	return NewWithOptions(c.Options()...)
+}
+
+// String returns a printable representation of the Config with the sentry credentials masked
+func (c *Config) String() string {
+	return fmt.Sprintf(
+		"level=%s levels=%q local=%t sentryDSN=%q sentryEnvironment=%q sentryLevel=%s release=%q file=%q fileLevel=%s",
+		c.Level, c.Levels, c.Local, maskDSN(c.SentryDSN), c.SentryEnvironment, c.SentryLevel, c.Release, c.File.Path, c.FileLevel,
+	)
+}
+
+func envKey(prefix, key string) string {
+	if len(prefix) == 0 {
+		return key
+	}
+	return strings.TrimSuffix(prefix, "_") + "_" + key
+}
+
+func lookupEnv(prefix, key string) (string, bool) {
+	value, ok := os.LookupEnv(envKey(prefix, key))
+	return strings.TrimSpace(value), ok && len(strings.TrimSpace(value)) > 0
+}
+
+func validateDSN(dsn string) error {
+	uri, err := url.Parse(dsn)
+	if err != nil {
+		return err
+	}
+	if uri.User == nil {
+		return errors.New("missing public key")
+	}
+	if len(strings.Trim(uri.Path, "/")) == 0 {
+		return errors.New("missing project id")
+	}
+	return nil
+}
+
+// maskDSN replaces the credentials of dsn by "***"
+// A dsn which cannot be parsed is replaced completely, as it might contain credentials in unexpected places.
+// The result is built by hand, as url.URL would escape the asterisks
+func maskDSN(dsn string) string {
+	if len(dsn) == 0 {
+		return dsn
+	}
+	uri, err := url.Parse(dsn)
+	if err != nil || len(uri.Scheme) == 0 || len(uri.Host) == 0 {
+		return "***"
+	}
+	if uri.User == nil {
+		return dsn
+	}
+	masked := uri.Scheme + "://***@" + uri.Host + uri.EscapedPath()
+	if len(uri.RawQuery) > 0 {
+		masked += "?" + uri.RawQuery
+	}
+	return masked
+}
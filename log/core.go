@@ -0,0 +1,156 @@
+package log
+
+import (
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// allLevels is used for the cores of all sinks, as levels are being checked by the routingCore
+var allLevels = zap.LevelEnablerFunc(func(zapcore.Level) bool { return true })
+
+// sinkCore is the core of a single sink together with the level it is checked against
+type sinkCore struct {
+	sink  Sink
+	level zap.AtomicLevel
+	core  zapcore.Core
+}
+
+// routingCore passes entries to all sinks whose level is enabled
+// Derived cores share the sink levels, so runtime changes apply to all of them
+type routingCore struct {
+	sinks []sinkCore
+	spec  *levelSpecValue
+
+	// override is a minimum level applied to all output sinks in addition to their own level
+	override *zapcore.Level
+}
+
+func newRoutingCore(spec *levelSpecValue, sinks ...sinkCore) *routingCore {
+	return &routingCore{sinks: sinks, spec: spec}
+}
+
+// withOverride returns a copy of the core additionally enabling all output sinks for level and above
+// Sentry is excluded, so temporary debugging does not report to it
+func (c *routingCore) withOverride(level zapcore.Level) *routingCore {
+	clone := *c
+	clone.override = &level
+	return &clone
+}
+
+// routingOption derives a new routingCore from the one it is applied to
+// It is passed as field, so it reaches the routingCore through all cores wrapping it, e.g. by zap.Hooks
+type routingOption func(*routingCore) *routingCore
+
+// routingKey is the key of the fields carrying a routingOption
+const routingKey = "_routing_option"
+
+func routingField(opt routingOption) zapcore.Field {
+	return zapcore.Field{Key: routingKey, Type: zapcore.SkipType, Interface: opt}
+}
+
+// withSentry returns a copy of the core with the sentry sink replaced by the result of fn
+func (c *routingCore) withSentry(fn func(*sentryCore) *sentryCore) *routingCore {
+	clone := *c
+	clone.sinks = make([]sinkCore, len(c.sinks))
+	for i, s := range c.sinks {
+		if sentry, ok := s.core.(*sentryCore); ok {
+			s.core = fn(sentry)
+		}
+		clone.sinks[i] = s
+	}
+	return &clone
+}
+
+// enabled checks lvl against the level of the sink, shifted by the level spec rule matching name
+// The sentry core checks its own level, as it also records breadcrumbs below it
+func (c *routingCore) enabled(s sinkCore, name string, lvl zapcore.Level) bool {
+	if s.sink == SinkSentry {
+		return s.core.Enabled(lvl)
+	}
+	if c.override != nil && c.override.Enabled(lvl) {
+		return true
+	}
+	rules := c.spec.load()
+	if rule, ok := rules.spec.Level(name); ok {
+		return rules.shift(s.level.Level(), rule).Enabled(lvl)
+	}
+	return s.level.Enabled(lvl)
+}
+
+// Enabled returns true if any sink or level spec rule might be enabled for lvl
+// The exact check including the logger name happens in Check
+func (c *routingCore) Enabled(lvl zapcore.Level) bool {
+	rules := c.spec.load()
+	for _, s := range c.sinks {
+		if s.sink == SinkSentry {
+			if s.core.Enabled(lvl) {
+				return true
+			}
+			continue
+		}
+		if s.level.Enabled(lvl) {
+			return true
+		}
+		if c.override != nil && c.override.Enabled(lvl) {
+			return true
+		}
+		if len(rules.spec) > 0 && rules.shift(s.level.Level(), rules.min).Enabled(lvl) {
+			return true
+		}
+	}
+	return false
+}
+
+// With adds fields to all sinks and applies the routing options passed as fields
+func (c *routingCore) With(fields []zapcore.Field) zapcore.Core {
+	derived, rest := c, fields[:0:0]
+	for _, field := range fields {
+		if opt, ok := field.Interface.(routingOption); ok && field.Key == routingKey {
+			derived = opt(derived)
+			continue
+		}
+		rest = append(rest, field)
+	}
+	if len(rest) == 0 {
+		return derived
+	}
+
+	clone := *derived
+	clone.sinks = make([]sinkCore, len(derived.sinks))
+	for i, s := range derived.sinks {
+		s.core = s.core.With(rest)
+		clone.sinks[i] = s
+	}
+	return &clone
+}
+
+// Check adds all sinks enabled for the entry to the CheckedEntry
+func (c *routingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	for _, s := range c.sinks {
+		if c.enabled(s, ent.LoggerName, ent.Level) {
+			ce = s.core.Check(ent, ce)
+		}
+	}
+	return ce
+}
+
+// Write the entry to all sinks enabled for it
+func (c *routingCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	var err error
+	for _, s := range c.sinks {
+		if c.enabled(s, ent.LoggerName, ent.Level) {
+			err = multierr.Append(err, s.core.Write(ent, fields))
+		}
+	}
+	return err
+}
+
+// Sync all sinks
+func (c *routingCore) Sync() error {
+	var err error
+	for _, s := range c.sinks {
+		err = multierr.Append(err, s.core.Sync())
+	}
+	return err
+}
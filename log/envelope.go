@@ -0,0 +1,166 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/getsentry/raven-go"
+	"github.com/pkg/errors"
+)
+
+// envelopeQueueSize matches the queue size of raven.Client
+const envelopeQueueSize = 100
+
+// envelopeReporter is the ErrorReporter sending events to the envelope endpoint of sentry
+type envelopeReporter struct {
+	url, auth, project string
+	http               *http.Client
+	spool              *sentrySpool
+
+	mu          sync.RWMutex
+	release     string
+	environment string
+
+	queue     chan envelopeEvent
+	pending   sync.WaitGroup
+	start     sync.Once
+	closeOnce sync.Once
+}
+
+type envelopeEvent struct {
+	packet *raven.Packet
+	done   func(error)
+}
+
+// NewEnvelopeReporter returns an ErrorReporter sending events to the envelope endpoint of dsn
+func NewEnvelopeReporter(dsn string) (ErrorReporter, error) {
+	return newEnvelopeReporter(dsn)
+}
+
+func newEnvelopeReporter(dsn string) (*envelopeReporter, error) {
+	endpoint, err := parseSentryDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &envelopeReporter{
+		url:     endpoint.url("envelope"),
+		auth:    endpoint.auth(7),
+		project: endpoint.project,
+		http:    &http.Client{Timeout: 30 * time.Second},
+		queue:   make(chan envelopeEvent, envelopeQueueSize),
+	}, nil
+}
+
+// Capture implements ErrorReporter
+func (e *envelopeReporter) Capture(packet *raven.Packet, done func(error)) {
+	e.mu.RLock()
+	if len(packet.Release) == 0 {
+		packet.Release = e.release
+	}
+	if len(packet.Environment) == 0 {
+		packet.Environment = e.environment
+	}
+	e.mu.RUnlock()
+
+	if err := packet.Init(e.project); err != nil {
+		done(err)
+		return
+	}
+
+	e.start.Do(func() {
+		go e.worker()
+	})
+
+	e.pending.Add(1)
+	select {
+	case e.queue <- envelopeEvent{packet: packet, done: done}:
+	default:
+		e.pending.Done()
+		done(ErrEventDropped)
+	}
+}
+
+// Flush implements ErrorReporter
+func (e *envelopeReporter) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	go func() {
+		e.pending.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close implements ErrorReporter
+func (e *envelopeReporter) Close() error {
+	e.closeOnce.Do(func() {
+		close(e.queue)
+	})
+	return nil
+}
+
+// SetRelease implements ErrorReporter
+func (e *envelopeReporter) SetRelease(release string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.release = release
+}
+
+// SetEnvironment implements ErrorReporter
+func (e *envelopeReporter) SetEnvironment(environment string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.environment = environment
+}
+
+func (e *envelopeReporter) worker() {
+	for event := range e.queue {
+		event.done(e.send(event.packet))
+		e.pending.Done()
+	}
+}
+
+func (e *envelopeReporter) send(packet *raven.Packet) error {
+	data, err := packet.JSON()
+	if err != nil {
+		return errors.Wrap(err, "encoding sentry event")
+	}
+	err = e.post(data)
+	if e.spool != nil {
+		return e.spool.handle(packet.EventID, data, err)
+	}
+	return err
+}
+
+// post wraps the event payload data into an envelope and sends it
+func (e *envelopeReporter) post(data []byte) error {
+	var event struct {
+		EventID string `json:"event_id"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return errors.Wrap(err, "decoding sentry event")
+	}
+
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	enc.Encode(map[string]string{
+		"event_id": event.EventID,
+		"sent_at":  time.Now().UTC().Format(time.RFC3339),
+	})
+	enc.Encode(map[string]interface{}{
+		"type":   "event",
+		"length": len(data),
+	})
+	body.Write(data)
+	body.WriteByte('\n')
+
+	return postEvent(e.http, e.url, e.auth, "application/x-sentry-envelope", body.Bytes())
+}
@@ -0,0 +1,272 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/getsentry/raven-go"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// StackTraceKey is the field holding the stack trace of the error origin in stackdriver entries
+const StackTraceKey = "stack_trace"
+
+// maxCauses limits the unwrapped cause chain to protect against cycles
+const maxCauses = 32
+
+// stackTracer is implemented by errors created or wrapped by github.com/pkg/errors
+type stackTracer interface {
+	StackTrace() errors.StackTrace
+}
+
+// causes returns the chain of err and all its causes, outermost first
+// Both github.com/pkg/errors Cause and Go 1.13 Unwrap are followed
+func causes(err error) []error {
+	var chain []error
+	for err != nil && len(chain) < maxCauses {
+		chain = append(chain, err)
+
+		var next error
+		switch e := err.(type) {
+		case interface{ Cause() error }:
+			next = e.Cause()
+		case interface{ Unwrap() error }:
+			next = e.Unwrap()
+		}
+		if next == err {
+			break
+		}
+		err = next
+	}
+	return chain
+}
+
+// innermostStackTrace returns the stack of the innermost error in the chain recording one
+func innermostStackTrace(err error) errors.StackTrace {
+	var stack errors.StackTrace
+	for _, e := range causes(err) {
+		if tracer, ok := e.(stackTracer); ok {
+			stack = tracer.StackTrace()
+		}
+	}
+	return stack
+}
+
+// newExceptions reports every cause of err as separate exception, innermost first as expected by sentry
+// Layers only adding a stack, like errors.WithStack, are merged into their cause.
+// The outermost exception gets the stack of the log site unless it recorded its own.
+func newExceptions(err error, logSite *raven.Stacktrace) *raven.Exceptions {
+	chain := causes(err)
+
+	var (
+		values  []*raven.Exception
+		carried *raven.Stacktrace
+	)
+	for i, e := range chain {
+		var next error
+		if i+1 < len(chain) {
+			next = chain[i+1]
+		}
+
+		var stack *raven.Stacktrace
+		if _, ok := e.(stackTracer); ok {
+			stack = raven.GetOrNewStacktrace(e, 0, sentryStackTraceContext, nil)
+		}
+
+		message := e.Error()
+		if next != nil && message == next.Error() {
+			if stack != nil {
+				carried = stack
+			}
+			continue
+		}
+		if stack == nil {
+			stack = carried
+		}
+		carried = nil
+
+		if next != nil {
+			message = strings.TrimSuffix(message, ": "+next.Error())
+		}
+		values = append(values, &raven.Exception{
+			Value:      message,
+			Type:       reflect.TypeOf(e).String(),
+			Stacktrace: stack,
+		})
+	}
+
+	if len(values) > 0 && values[0].Stacktrace == nil {
+		values[0].Stacktrace = logSite
+	}
+	for i, j := 0, len(values)-1; i < j; i, j = i+1, j-1 {
+		values[i], values[j] = values[j], values[i]
+	}
+	return &raven.Exceptions{Values: values}
+}
+
+// trimLogFrames removes the frames of zap and this package from the end of stack, which sentry orders oldest first
+func trimLogFrames(stack *raven.Stacktrace) *raven.Stacktrace {
+	if stack == nil {
+		return nil
+	}
+	frames := stack.Frames
+	for len(frames) > 1 {
+		module := frames[len(frames)-1].Module
+		if module != logPackage && !strings.HasPrefix(module, "go.uber.org/zap") {
+			break
+		}
+		frames = frames[:len(frames)-1]
+	}
+	return &raven.Stacktrace{Frames: frames}
+}
+
+var logPackage = reflect.TypeOf(Logger{}).PkgPath()
+
+// formatStackTrace formats stack like a Go panic, so stackdriver error reporting is able to parse it
+func formatStackTrace(message string, stack errors.StackTrace) string {
+	var buf bytes.Buffer
+	buf.WriteString(message)
+	buf.WriteString("\n\ngoroutine 1 [running]:\n")
+	for _, f := range stack {
+		pc := uintptr(f) - 1
+		fn := runtime.FuncForPC(pc)
+		if fn == nil {
+			continue
+		}
+		file, line := fn.FileLine(pc)
+		fmt.Fprintf(&buf, "%s()\n\t%s:%d\n", fn.Name(), file, line)
+	}
+	return buf.String()
+}
+
+// Keys and type of the fields marking stackdriver entries as ReportedErrorEvent
+const (
+	ErrorReportingTypeKey    = "@type"
+	ErrorReportingType       = "type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"
+	ErrorReportingServiceKey = "serviceContext"
+)
+
+// serviceContext identifies the service reporting errors to stackdriver error reporting
+type serviceContext struct {
+	service string
+	version string
+}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler
+func (s *serviceContext) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("service", s.service)
+	if len(s.version) > 0 {
+		enc.AddString("version", s.version)
+	}
+	return nil
+}
+
+// stackTraceCore adds the stack trace of the error origin to entries at Error level and above
+// The innermost stack recorded by github.com/pkg/errors is used, so error reporting groups by the original origin.
+// With a service set, all these entries are marked as ReportedErrorEvent and fall back to the stack of the log site.
+// The release of the logger at the time of writing is reported as service version.
+type stackTraceCore struct {
+	zapcore.Core
+	err     error
+	service string
+	meta    sentryMeta
+}
+
+func newStackTraceCore(core zapcore.Core, service string, meta sentryMeta) zapcore.Core {
+	return &stackTraceCore{Core: core, service: service, meta: meta}
+}
+
+// With keeps the last error field to be used for entries not passing their own and the meta of derived loggers
+func (c *stackTraceCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := &stackTraceCore{Core: c.Core.With(fields), err: c.err, service: c.service, meta: c.meta}
+	if err := errorField(fields); err != nil {
+		clone.err = err
+	}
+	if meta, ok := metaOf(fields); ok {
+		clone.meta = meta
+	}
+	return clone
+}
+
+// Check adds the core if the wrapped core is enabled
+func (c *stackTraceCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write adds the stack_trace field if the entry contains an error with stack
+func (c *stackTraceCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if ent.Level < zapcore.ErrorLevel {
+		return c.Core.Write(ent, fields)
+	}
+	fields = fields[:len(fields):len(fields)]
+	if len(c.service) > 0 {
+		fields = append(fields,
+			zap.String(ErrorReportingTypeKey, ErrorReportingType),
+			zap.Object(ErrorReportingServiceKey, &serviceContext{service: c.service, version: c.meta.currentRelease()}),
+		)
+	}
+	for _, field := range fields {
+		if field.Key == StackTraceKey {
+			return c.Core.Write(ent, fields)
+		}
+	}
+
+	err := errorField(fields)
+	if err == nil {
+		err = c.err
+	}
+	var stack errors.StackTrace
+	if err != nil {
+		stack = innermostStackTrace(err)
+	}
+	if len(stack) > 0 {
+		return c.Core.Write(ent, append(fields, zap.String(StackTraceKey, formatStackTrace(err.Error(), stack))))
+	}
+	if len(c.service) == 0 {
+		return c.Core.Write(ent, fields)
+	}
+	message := ent.Message
+	if err != nil {
+		message += ": " + err.Error()
+	}
+	return c.Core.Write(ent, append(fields, zap.String(StackTraceKey, formatStackTrace(message, logSiteStackTrace()))))
+}
+
+// logSiteStackTrace returns the stack of the caller, skipping the frames of zap and this package
+func logSiteStackTrace() errors.StackTrace {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(2, pcs)
+	stack := make(errors.StackTrace, 0, n)
+	for _, pc := range pcs[:n] {
+		if len(stack) == 0 {
+			fn := runtime.FuncForPC(pc - 1)
+			if fn != nil && (strings.HasPrefix(fn.Name(), logPackage+".") || strings.HasPrefix(fn.Name(), "go.uber.org/zap")) {
+				continue
+			}
+		}
+		stack = append(stack, errors.Frame(pc))
+	}
+	return stack
+}
+
+// errorField returns the error of the last error field
+func errorField(fields []zapcore.Field) error {
+	var err error
+	for _, field := range fields {
+		if field.Type != zapcore.ErrorType {
+			continue
+		}
+		if e, ok := field.Interface.(error); ok {
+			err = e
+		}
+	}
+	return err
+}
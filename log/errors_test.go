@@ -0,0 +1,162 @@
+package log_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/getsentry/raven-go"
+	"github.com/pkg/errors"
+	"github.com/seibert-media/golibs/log"
+	"github.com/seibert-media/golibs/logtest/sentrytest"
+	"go.uber.org/zap"
+)
+
+// unwrapError implements the Go 1.13 Unwrap method
+type unwrapError struct {
+	msg   string
+	cause error
+}
+
+func (e *unwrapError) Error() string { return e.msg + ": " + e.cause.Error() }
+func (e *unwrapError) Unwrap() error { return e.cause }
+
+func originError() error {
+	return errors.New("connection refused")
+}
+
+func Test_SentryCauses(t *testing.T) {
+	server := sentrytest.NewServer()
+	defer server.Close()
+	logger, _ := newTestLogger(t, log.OptSentryDSN(server.DSN()))
+
+	err := &unwrapError{msg: "handling request", cause: errors.Wrap(originError(), "querying db")}
+	logger.Error("failed", zap.Error(err))
+	logger.Sync()
+
+	event := server.AssertEvent(t, "failed", raven.ERROR)
+	var exceptions raven.Exceptions
+	if err := event.Interface("exception", &exceptions); err != nil {
+		t.Fatal("decoding exceptions failed with:", err)
+	}
+	var values []string
+	for _, ex := range exceptions.Values {
+		values = append(values, ex.Value)
+	}
+	if strings.Join(values, "|") != "connection refused|querying db|handling request" {
+		t.Fatal("all causes should be reported innermost first, got:", values)
+	}
+
+	origin := exceptions.Values[0].Stacktrace
+	if origin == nil || origin.Frames[len(origin.Frames)-1].Function != "originError" {
+		t.Fatal("innermost exception should have the stack of its origin, got:", origin)
+	}
+	wrapped := exceptions.Values[1].Stacktrace
+	if wrapped == nil || wrapped.Frames[len(wrapped.Frames)-1].Function != "Test_SentryCauses" {
+		t.Fatal("wrapping exception should have the stack of the wrap site, got:", wrapped)
+	}
+	logSite := exceptions.Values[2].Stacktrace
+	if logSite == nil || logSite.Frames[len(logSite.Frames)-1].Function != "Test_SentryCauses" {
+		t.Fatal("outermost exception should have the stack of the log site without zap frames, got:", logSite)
+	}
+}
+
+func Test_StackdriverStackTrace(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := log.NewWithOptions(log.OptOutput(&buf))
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+
+	logger.Error("failed", zap.Error(errors.Wrap(originError(), "querying db")))
+	logger.Warn("warning", zap.Error(originError()))
+	logger.Error("without stack", zap.Error(fmt.Errorf("plain")))
+	logger.WithFields(zap.Error(originError())).Error("from fields")
+
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal("decoding entry failed with:", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	stack, _ := entries[0][log.StackTraceKey].(string)
+	if !strings.HasPrefix(stack, "querying db: connection refused\n\ngoroutine 1 [running]:\n") {
+		t.Fatal("stack trace should be formatted like a panic, got:", stack)
+	}
+	if !strings.Contains(stack, "log_test.originError()\n\t") {
+		t.Fatal("stack trace should point to the origin, got:", stack)
+	}
+	if _, ok := entries[1][log.StackTraceKey]; ok {
+		t.Fatal("stack trace should only be added at error level")
+	}
+	if _, ok := entries[2][log.StackTraceKey]; ok {
+		t.Fatal("stack trace should only be added for errors with stack")
+	}
+	if _, ok := entries[3][log.StackTraceKey]; !ok {
+		t.Fatal("stack trace should be added for errors passed as logger fields")
+	}
+}
+
+func Test_ErrorReporting(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := log.NewWithLevel("", false, zap.NewAtomicLevel(),
+		log.OptOutput(&buf),
+		log.OptRelease("v1.0.0"),
+		log.OptErrorReporting("shop"),
+	)
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+
+	logger.Error("failed", zap.Error(errors.Wrap(originError(), "querying db")))
+	logger.Error("without stack", zap.Error(fmt.Errorf("plain")))
+	logger.Warn("warning")
+
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal("decoding entry failed with:", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	for _, entry := range entries[:2] {
+		if entry[log.ErrorReportingTypeKey] != log.ErrorReportingType {
+			t.Fatal("entry should be marked as reported error, got:", entry)
+		}
+		service, _ := entry[log.ErrorReportingServiceKey].(map[string]interface{})
+		if service["service"] != "shop" || service["version"] != "v1.0.0" {
+			t.Fatal("service context should contain service and release, got:", service)
+		}
+	}
+	if stack, _ := entries[0][log.StackTraceKey].(string); !strings.Contains(stack, "log_test.originError()\n\t") {
+		t.Fatal("stack trace should point to the origin, got:", stack)
+	}
+	stack, _ := entries[1][log.StackTraceKey].(string)
+	if !strings.HasPrefix(stack, "without stack: plain\n\ngoroutine 1 [running]:\ngithub.com/seibert-media/golibs/log_test.Test_ErrorReporting()\n\t") {
+		t.Fatal("stack trace should fall back to the log site, got:", stack)
+	}
+	if _, ok := entries[2][log.ErrorReportingTypeKey]; ok {
+		t.Fatal("entries below error should not be marked, got:", entries[2])
+	}
+}
+
+func Test_ErrorReportingRelease(t *testing.T) {
+	logger, buf := newTestLogger(t, log.OptLocal(false), log.OptRelease("v1"), log.OptErrorReporting("shop"))
+	logger.WithReleaseOverride("v2").Error("overridden")
+	logger.WithRelease("v3").Error("changed")
+
+	entries := decodeEntries(t, buf)
+	for i, expected := range []string{"v2", "v3"} {
+		service, _ := entries[i][log.ErrorReportingServiceKey].(map[string]interface{})
+		if service["version"] != expected {
+			t.Fatal("service version should be the release of the logger, got:", service)
+		}
+	}
+}
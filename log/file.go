@@ -0,0 +1,412 @@
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blendle/zapdriver"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// FileFormat defines the encoding of entries written to a file sink
+type FileFormat string
+
+// Available file formats
+const (
+	FileFormatJSON    FileFormat = "json"
+	FileFormatConsole FileFormat = "console"
+)
+
+// String implements flag.Value
+func (f *FileFormat) String() string {
+	return string(*f)
+}
+
+// Set implements flag.Value
+func (f *FileFormat) Set(value string) error {
+	switch format := FileFormat(strings.ToLower(value)); format {
+	case FileFormatJSON, FileFormatConsole:
+		*f = format
+		return nil
+	default:
+		return errors.Errorf("unknown file format %q", value)
+	}
+}
+
+// rotatedTimeFormat is appended to the path of rotated files and sorts chronologically
+const rotatedTimeFormat = "20060102T150405.000"
+
+// FileConfig configures the rotating file sink
+type FileConfig struct {
+	// Path of the active log file, rotated files are stored next to it
+	Path string
+	// Format of the written entries, defaults to json
+	Format FileFormat
+	// MaxSize in bytes after which the file gets rotated, 0 disables size based rotation
+	MaxSize int64
+	// MaxAge after which the file gets rotated, 0 disables age based rotation
+	MaxAge time.Duration
+	// MaxBackups is the number of rotated files to keep, 0 keeps all of them
+	MaxBackups int
+	// Compress rotated files using gzip
+	Compress bool
+	// ReopenOnSIGHUP reopens the file when the process receives SIGHUP, e.g. after an external logrotate
+	// This is only supported on unix platforms
+	ReopenOnSIGHUP bool
+	// ErrorOutput receives failures of reopening, compressing and removing files in the background, defaults to os.Stderr
+	ErrorOutput io.Writer
+}
+
+// RotatingFile implements zapcore.WriteSyncer writing to a file which gets rotated by size and age
+type RotatingFile struct {
+	config FileConfig
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+
+	// background compression and cleanup of rotated files
+	wg      sync.WaitGroup
+	cleanup sync.Mutex
+
+	signals chan os.Signal
+	done    chan struct{}
+}
+
+// NewRotatingFile opens the file at config.Path for appending
+// If ReopenOnSIGHUP is set, the file starts listening for SIGHUP until it gets closed
+func NewRotatingFile(config FileConfig) (*RotatingFile, error) {
+	if len(config.Path) == 0 {
+		return nil, errors.New("file sink requires a path")
+	}
+	switch config.Format {
+	case "":
+		config.Format = FileFormatJSON
+	case FileFormatJSON, FileFormatConsole:
+	default:
+		return nil, errors.Errorf("unknown file format %q", config.Format)
+	}
+
+	if config.ErrorOutput == nil {
+		config.ErrorOutput = os.Stderr
+	}
+
+	f := &RotatingFile{config: config}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	if config.ReopenOnSIGHUP {
+		f.notifySIGHUP()
+	}
+
+	return f, nil
+}
+
+// Write p to the file, rotating it beforehand if the size or age limit would be exceeded
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, errors.New("file sink is closed")
+	}
+
+	if f.shouldRotate(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Sync commits the current contents of the file to disk
+func (f *RotatingFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Sync()
+}
+
+// Rotate moves the active file aside and starts a new one
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return errors.New("file sink is closed")
+	}
+	return f.rotate()
+}
+
+// Reopen closes and reopens the file at the configured path without rotating it
+// This is meant to be used after the file got moved by an external tool
+func (f *RotatingFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return errors.New("file sink is closed")
+	}
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// Close the file and stop listening for signals
+// Pending compressions of rotated files are being waited for
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+
+	if f.done != nil {
+		signal.Stop(f.signals)
+		close(f.done)
+		f.done = nil
+	}
+
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.mu.Unlock()
+
+	f.wg.Wait()
+	return err
+}
+
+// Path of the active file
+func (f *RotatingFile) Path() string {
+	return f.config.Path
+}
+
+func (f *RotatingFile) handleSignals(signals <-chan os.Signal, done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-signals:
+			if err := f.Reopen(); err != nil {
+				fmt.Fprintf(f.config.ErrorOutput, "log: reopening %s failed: %v\n", f.config.Path, err)
+			}
+		}
+	}
+}
+
+func (f *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.config.Path), 0755); err != nil {
+		return errors.Wrap(err, "creating log directory")
+	}
+
+	file, err := os.OpenFile(f.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrap(err, "opening log file")
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.Wrap(err, "reading log file info")
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.opened = time.Now()
+	if f.size > 0 {
+		f.opened = f.created(info)
+	}
+	return nil
+}
+
+// created estimates when the existing file at the configured path was started, so reopening it keeps its age
+// This is the time of the last rotation if there is a rotated file, its modification time otherwise
+func (f *RotatingFile) created(info os.FileInfo) time.Time {
+	if backups, err := f.backups(); err == nil && len(backups) > 0 {
+		if t, ok := rotatedTime(f.config.Path, backups[len(backups)-1]); ok {
+			return t
+		}
+	}
+	return info.ModTime()
+}
+
+func (f *RotatingFile) shouldRotate(next int64) bool {
+	if f.config.MaxSize > 0 && f.size > 0 && f.size+next > f.config.MaxSize {
+		return true
+	}
+	if f.config.MaxAge > 0 && time.Since(f.opened) >= f.config.MaxAge {
+		return true
+	}
+	return false
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return f.restore(err)
+	}
+
+	rotated := f.rotatedPath(time.Now())
+	if err := os.Rename(f.config.Path, rotated); err != nil && !os.IsNotExist(err) {
+		return f.restore(errors.Wrap(err, "moving log file"))
+	}
+
+	if err := f.open(); err != nil {
+		return f.restore(err)
+	}
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		f.cleanup.Lock()
+		defer f.cleanup.Unlock()
+		if f.config.Compress {
+			// the file might already be removed by the cleanup of a previous rotation
+			if err := compressFile(rotated); err != nil && !os.IsNotExist(err) {
+				fmt.Fprintf(f.config.ErrorOutput, "log: compressing %s failed: %v\n", rotated, err)
+			}
+		}
+		if err := f.removeBackups(); err != nil {
+			fmt.Fprintf(f.config.ErrorOutput, "log: removing old log files failed: %v\n", err)
+		}
+	}()
+
+	return nil
+}
+
+// restore reopens the file after a failed rotation, so later writes keep appending to it
+// If that fails as well, the file is marked as closed
+func (f *RotatingFile) restore(err error) error {
+	if openErr := f.open(); openErr != nil {
+		f.file = nil
+		return multierr.Append(err, openErr)
+	}
+	return err
+}
+
+// rotatedPath returns an unused path for the file rotated at t
+func (f *RotatingFile) rotatedPath(t time.Time) string {
+	base := f.config.Path + "." + t.Format(rotatedTimeFormat)
+	path := base
+	for i := 1; exists(path) || exists(path+".gz"); i++ {
+		path = fmt.Sprintf("%s-%d", base, i)
+	}
+	return path
+}
+
+// backups returns all rotated files, oldest first
+func (f *RotatingFile) backups() ([]string, error) {
+	matches, err := filepath.Glob(f.config.Path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	backups := matches[:0]
+	for _, match := range matches {
+		if isRotatedPath(f.config.Path, match) {
+			backups = append(backups, match)
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// isRotatedPath returns true if path has been created by rotating the file at base, other files are never removed
+func isRotatedPath(base, path string) bool {
+	_, ok := rotatedTime(base, path)
+	return ok
+}
+
+// rotatedTime returns the time the file at base got rotated to path
+func rotatedTime(base, path string) (time.Time, bool) {
+	suffix := strings.TrimSuffix(strings.TrimPrefix(path, base+"."), ".gz")
+	if i := strings.LastIndex(suffix, "-"); i >= 0 {
+		if _, err := strconv.Atoi(suffix[i+1:]); err == nil {
+			suffix = suffix[:i]
+		}
+	}
+	t, err := time.ParseInLocation(rotatedTimeFormat, suffix, time.Local)
+	return t, err == nil
+}
+
+func (f *RotatingFile) removeBackups() error {
+	if f.config.MaxBackups <= 0 {
+		return nil
+	}
+
+	backups, err := f.backups()
+	if err != nil {
+		return err
+	}
+
+	for len(backups) > f.config.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func buildFileLogger(level zapcore.LevelEnabler, file *RotatingFile) zapcore.Core {
+	var encoder zapcore.Encoder
+	local := file.config.Format == FileFormatConsole
+	if local {
+		encoder = zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig())
+	} else {
+		encoder = zapcore.NewJSONEncoder(zapdriver.NewProductionEncoderConfig())
+	}
+	return newStackdriverCore(zapcore.NewCore(encoder, file, level), local)
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+// +build !unix
+
+package log
+
+// notifySIGHUP does nothing, as SIGHUP does not exist on this platform
+func (f *RotatingFile) notifySIGHUP() {}
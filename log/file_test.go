@@ -0,0 +1,268 @@
+package log_test
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seibert-media/golibs/log"
+	"go.uber.org/zap"
+)
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "golibs-log")
+	if err != nil {
+		t.Fatal("creating temp dir failed with:", err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func rotated(t *testing.T, path string) []string {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal("listing rotated files failed with:", err)
+	}
+	return matches
+}
+
+func Test_RotatingFileSize(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "test.log")
+	file, err := log.NewRotatingFile(log.FileConfig{Path: path, MaxSize: 10})
+	if err != nil {
+		t.Fatal("creating file failed with:", err)
+	}
+	for _, line := range []string{"12345678\n", "12345678\n", "12345678\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatal("writing failed with:", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal("closing failed with:", err)
+	}
+
+	if files := rotated(t, path); len(files) != 2 {
+		t.Fatal("file should have been rotated twice, got:", files)
+	}
+	content, _ := ioutil.ReadFile(path)
+	if string(content) != "12345678\n" {
+		t.Fatal("active file should contain the last line, got:", string(content))
+	}
+}
+
+func Test_RotatingFileAge(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "test.log")
+	file, err := log.NewRotatingFile(log.FileConfig{Path: path, MaxAge: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal("creating file failed with:", err)
+	}
+	defer file.Close()
+
+	file.Write([]byte("first\n"))
+	time.Sleep(20 * time.Millisecond)
+	file.Write([]byte("second\n"))
+
+	if files := rotated(t, path); len(files) != 1 {
+		t.Fatal("file should have been rotated once, got:", files)
+	}
+}
+
+func Test_RotatingFileAgeAfterRestart(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "test.log")
+	if err := ioutil.WriteFile(path, []byte("before restart\n"), 0644); err != nil {
+		t.Fatal("writing file failed with:", err)
+	}
+	rotatedAt := time.Now().Add(-2 * time.Hour)
+	if err := ioutil.WriteFile(path+"."+rotatedAt.Format("20060102T150405.000"), nil, 0644); err != nil {
+		t.Fatal("writing rotated file failed with:", err)
+	}
+
+	file, err := log.NewRotatingFile(log.FileConfig{Path: path, MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal("creating file failed with:", err)
+	}
+	defer file.Close()
+
+	file.Write([]byte("after restart\n"))
+	if files := rotated(t, path); len(files) != 2 {
+		t.Fatal("file rotated two hours ago should be rotated after a restart, got:", files)
+	}
+}
+
+func Test_RotatingFileRetentionAndCompression(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "test.log")
+	file, err := log.NewRotatingFile(log.FileConfig{Path: path, MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatal("creating file failed with:", err)
+	}
+	for i := 0; i < 4; i++ {
+		file.Write([]byte("line\n"))
+		if err := file.Rotate(); err != nil {
+			t.Fatal("rotating failed with:", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal("closing failed with:", err)
+	}
+
+	files := rotated(t, path)
+	if len(files) != 2 {
+		t.Fatal("only two rotated files should be kept, got:", files)
+	}
+	for _, name := range files {
+		if !strings.HasSuffix(name, ".gz") {
+			t.Fatal("rotated file should be compressed, got:", name)
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal("opening rotated file failed with:", err)
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal("reading gzip failed with:", err)
+		}
+		content, _ := ioutil.ReadAll(gz)
+		f.Close()
+		if string(content) != "line\n" {
+			t.Fatal("rotated file has unexpected content:", string(content))
+		}
+	}
+}
+
+func Test_RotatingFileRetentionKeepsOtherFiles(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "test.log")
+	others := []string{path + ".1", path + ".lock", path + ".moved"}
+	for _, name := range others {
+		if err := ioutil.WriteFile(name, nil, 0644); err != nil {
+			t.Fatal("writing file failed with:", err)
+		}
+	}
+	file, err := log.NewRotatingFile(log.FileConfig{Path: path, MaxBackups: 1})
+	if err != nil {
+		t.Fatal("creating file failed with:", err)
+	}
+	for i := 0; i < 3; i++ {
+		file.Write([]byte("line\n"))
+		if err := file.Rotate(); err != nil {
+			t.Fatal("rotating failed with:", err)
+		}
+	}
+	file.Close()
+
+	if files := rotated(t, path); len(files) != len(others)+1 {
+		t.Fatal("only one rotated file should be kept besides the other files, got:", files)
+	}
+	for _, name := range others {
+		if _, err := os.Stat(name); err != nil {
+			t.Fatal("files not created by rotating should be kept, got:", err)
+		}
+	}
+}
+
+func Test_RotatingFileReopen(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "test.log")
+	file, err := log.NewRotatingFile(log.FileConfig{Path: path})
+	if err != nil {
+		t.Fatal("creating file failed with:", err)
+	}
+	defer file.Close()
+
+	file.Write([]byte("first\n"))
+	if err := os.Rename(path, path+".moved"); err != nil {
+		t.Fatal("moving file failed with:", err)
+	}
+	if err := file.Reopen(); err != nil {
+		t.Fatal("reopening failed with:", err)
+	}
+	file.Write([]byte("second\n"))
+
+	content, _ := ioutil.ReadFile(path)
+	if string(content) != "second\n" {
+		t.Fatal("reopened file should only contain the second line, got:", string(content))
+	}
+}
+
+func Test_RotatingFileInvalid(t *testing.T) {
+	if _, err := log.NewRotatingFile(log.FileConfig{}); err == nil {
+		t.Fatal("NewRotatingFile() should have returned error for missing path")
+	}
+	if _, err := log.NewRotatingFile(log.FileConfig{Path: "test.log", Format: "xml"}); err == nil {
+		t.Fatal("NewRotatingFile() should have returned error for unknown format")
+	}
+}
+
+func Test_NewWithFile(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "logs", "test.log")
+	logger, err := log.NewWithOptions(
+		log.OptOutput(ioutil.Discard),
+		log.OptFile(log.FileConfig{Path: path}),
+	)
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+	if logger.File == nil {
+		t.Fatal("file is nil")
+	}
+	logger.WithFields(zap.String("test", "value")).Info("message")
+	logger.File.Close()
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal("reading log file failed with:", err)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(content, &entry); err != nil {
+		t.Fatal("log file should contain json, got:", string(content))
+	}
+	if entry["message"] != "message" || entry["test"] != "value" {
+		t.Fatal("entry is missing message or fields, got:", entry)
+	}
+}
+
+func Test_NewWithFileInvalid(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	blocked := filepath.Join(dir, "blocked")
+	if err := ioutil.WriteFile(blocked, nil, 0644); err != nil {
+		t.Fatal("writing file failed with:", err)
+	}
+	spool := filepath.Join(dir, "spool")
+	_, err := log.NewWithOptions(
+		log.OptOutput(ioutil.Discard),
+		log.OptSentryDSN("http://test@localhost/test"),
+		log.OptSentrySpool(log.SpoolConfig{Dir: spool}),
+		log.OptFile(log.FileConfig{Path: filepath.Join(blocked, "test.log")}),
+	)
+	if err == nil {
+		t.Fatal("creating logger should fail for a file below a file")
+	}
+	if _, err := os.Stat(spool); !os.IsNotExist(err) {
+		t.Fatal("the spool should not be started if opening the file fails, got:", err)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build unix
+// +build unix
+
+package log
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifySIGHUP reopens the file whenever the process receives SIGHUP until the file gets closed
+func (f *RotatingFile) notifySIGHUP() {
+	f.signals = make(chan os.Signal, 1)
+	f.done = make(chan struct{})
+	signal.Notify(f.signals, syscall.SIGHUP)
+	go f.handleSignals(f.signals, f.done)
+}
@@ -0,0 +1,49 @@
+//go:build unix
+// +build unix
+
+package log_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/seibert-media/golibs/log"
+)
+
+func Test_RotatingFileSIGHUP(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "test.log")
+	file, err := log.NewRotatingFile(log.FileConfig{Path: path, ReopenOnSIGHUP: true})
+	if err != nil {
+		t.Fatal("creating file failed with:", err)
+	}
+	defer file.Close()
+
+	file.Write([]byte("first\n"))
+	if err := os.Rename(path, path+".moved"); err != nil {
+		t.Fatal("moving file failed with:", err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal("sending signal failed with:", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	file.Write([]byte("second\n"))
+
+	content, _ := ioutil.ReadFile(path)
+	if string(content) != "second\n" {
+		t.Fatal("reopened file should only contain the second line, got:", string(content))
+	}
+}
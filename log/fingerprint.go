@@ -0,0 +1,76 @@
+package log
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/tchap/zapext/zapsentry"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// FingerprintKey is the reserved field key holding the sentry fingerprint of an entry
+const FingerprintKey = "_sentry_fingerprint"
+
+// FingerprintDefault can be used as part of a Fingerprint to extend the default grouping of sentry
+const FingerprintDefault = "{{ default }}"
+
+// Fingerprint returns a field setting the parts sentry groups the event by
+// The field is only read by the sentry sink and never printed
+func Fingerprint(parts ...string) zapcore.Field {
+	return zap.Field{Key: FingerprintKey, Type: zapcore.SkipType, Interface: parts}
+}
+
+// defaultFingerprint groups events by their message, calling function and the type of the error cause
+func defaultFingerprint(ent zapcore.Entry, err error) []string {
+	fingerprint := []string{ent.Message}
+	if ent.Caller.Defined {
+		if fn := runtime.FuncForPC(ent.Caller.PC); fn != nil {
+			fingerprint = append(fingerprint, fn.Name())
+		} else {
+			fingerprint = append(fingerprint, ent.Caller.File)
+		}
+	}
+	if err != nil {
+		// the innermost cause, following Unwrap like the reported exceptions
+		chain := causes(err)
+		fingerprint = append(fingerprint, fmt.Sprintf("%T", chain[len(chain)-1]))
+	}
+	return fingerprint
+}
+
+// limitFingerprint returns the fingerprint sentry groups the entry by, used to rate limit similar events
+// FingerprintDefault parts are replaced by the default fingerprint, as sentry resolves them on its side
+func limitFingerprint(ent zapcore.Entry, coreFields, fields []zapcore.Field) []string {
+	var (
+		explicit []string
+		err      error
+	)
+	for _, fs := range [][]zapcore.Field{coreFields, fields} {
+		for _, field := range fs {
+			switch field.Key {
+			case FingerprintKey:
+				if parts, ok := field.Interface.([]string); ok {
+					explicit = parts
+				}
+			case zapsentry.ErrorKey:
+				if e, ok := field.Interface.(error); ok {
+					err = e
+				}
+			}
+		}
+	}
+	if len(explicit) == 0 {
+		return defaultFingerprint(ent, err)
+	}
+
+	fingerprint := make([]string, 0, len(explicit))
+	for _, part := range explicit {
+		if part == FingerprintDefault {
+			fingerprint = append(fingerprint, defaultFingerprint(ent, err)...)
+			continue
+		}
+		fingerprint = append(fingerprint, part)
+	}
+	return fingerprint
+}
@@ -0,0 +1,51 @@
+package log_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/getsentry/raven-go"
+	"github.com/pkg/errors"
+	"github.com/seibert-media/golibs/log"
+	"github.com/seibert-media/golibs/logtest/sentrytest"
+	"go.uber.org/zap"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string { return "timeout" }
+
+func Test_Fingerprint(t *testing.T) {
+	server := sentrytest.NewServer()
+	defer server.Close()
+	logger, buf := newTestLogger(t, log.OptSentryDSN(server.DSN()))
+
+	logger.Error("custom", log.Fingerprint("db", log.FingerprintDefault))
+	logger.Error("default", zap.Error(errors.Wrap(timeoutError{}, "querying")))
+	logger.Error("default")
+	logger.Error("unwrapped", zap.Error(&unwrapError{msg: "querying", cause: timeoutError{}}))
+	logger.Sync()
+
+	if strings.Contains(buf.String(), log.FingerprintKey) || strings.Contains(buf.String(), log.FingerprintDefault) {
+		t.Fatal("fingerprint should not be printed, got:", buf.String())
+	}
+
+	custom := server.AssertEvent(t, "custom", raven.ERROR)
+	if strings.Join(custom.Fingerprint, ",") != "db,{{ default }}" {
+		t.Fatal("custom fingerprint not set, got:", custom.Fingerprint)
+	}
+
+	events, _ := server.WaitForEvents(4, 0)
+	withError, withoutError, unwrapped := events[1], events[2], events[3]
+	if len(withError.Fingerprint) != 3 || withError.Fingerprint[0] != "default" ||
+		withError.Fingerprint[1] != "github.com/seibert-media/golibs/log_test.Test_Fingerprint" ||
+		withError.Fingerprint[2] != "log_test.timeoutError" {
+		t.Fatal("default fingerprint should contain message, caller and error type, got:", withError.Fingerprint)
+	}
+	if len(withoutError.Fingerprint) != 2 || withoutError.Fingerprint[1] != withError.Fingerprint[1] {
+		t.Fatal("default fingerprint without error should contain message and caller, got:", withoutError.Fingerprint)
+	}
+	if len(unwrapped.Fingerprint) != 3 || unwrapped.Fingerprint[2] != "log_test.timeoutError" {
+		t.Fatal("default fingerprint should follow Unwrap to the error type, got:", unwrapped.Fingerprint)
+	}
+}
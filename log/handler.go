@@ -0,0 +1,279 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LevelHandler returns a http.Handler to read and change the sink levels at runtime
+//
+// GET requests return the current levels and level spec, optionally limited to a single sink using the sink query parameter:
+//
+//	{"level":"info","sinks":{"console":"info","sentry":"error"},"levels":"db=debug"}
+//
+// PUT requests change the level of a sink, defaulting to the console or stackdriver output.
+// The payload can be sent as JSON or form encoded, ttl reverts the change after the given duration:
+//
+//	{"level":"debug","sink":"console","ttl":"10m"}
+//	level=debug&sink=console&ttl=10m
+//
+// The level spec is replaced by passing levels, an empty string removes all rules:
+//
+//	{"levels":"db=debug,*=info"}
+//
+// Every change is logged through the Logger at Warn, before raising and after lowering the level, so the entry is not dropped.
+// If both levels are above Warn, the entry is written at the more verbose one, capped at Error.
+// A nop logger responds with 404 Not Found
+func (l *Logger) LevelHandler() http.Handler {
+	return &levelHandler{
+		logger:  l,
+		reverts: make(map[Sink]*levelRevert),
+	}
+}
+
+type levelHandler struct {
+	logger *Logger
+
+	mu      sync.Mutex
+	reverts map[Sink]*levelRevert
+}
+
+// levelRevert is a pending reset of a sink to its level before the first temporary change
+type levelRevert struct {
+	timer *time.Timer
+	to    zapcore.Level
+}
+
+type levelRequest struct {
+	Level  *zapcore.Level `json:"level"`
+	Sink   Sink           `json:"sink,omitempty"`
+	TTL    string         `json:"ttl,omitempty"`
+	Levels *LevelSpec     `json:"levels,omitempty"`
+}
+
+type levelResponse struct {
+	Sink   Sink                   `json:"sink,omitempty"`
+	Level  zapcore.Level          `json:"level"`
+	Sinks  map[Sink]zapcore.Level `json:"sinks,omitempty"`
+	Levels *LevelSpec             `json:"levels,omitempty"`
+	TTL    string                 `json:"ttl,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+}
+
+func (h *levelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+
+	// a nop logger has no sinks whose level could be read or changed
+	if h.logger.IsNop() {
+		w.WriteHeader(http.StatusNotFound)
+		enc.Encode(levelResponse{Error: "logging is disabled"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		sink := Sink(r.URL.Query().Get("sink"))
+		if len(sink) > 0 {
+			level, ok := h.logger.SinkLevel(sink)
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				enc.Encode(levelResponse{Error: errors.Errorf("sink %q is not configured", sink).Error()})
+				return
+			}
+			enc.Encode(levelResponse{Sink: sink, Level: level.Level()})
+			return
+		}
+		sinks := make(map[Sink]zapcore.Level)
+		for _, sink := range h.logger.Sinks() {
+			level, _ := h.logger.SinkLevel(sink)
+			sinks[sink] = level.Level()
+		}
+		spec := h.logger.LevelSpec()
+		enc.Encode(levelResponse{Level: h.logger.Level.Level(), Sinks: sinks, Levels: &spec})
+
+	case http.MethodPut:
+		req, err := decodeLevelRequest(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			enc.Encode(levelResponse{Error: err.Error()})
+			return
+		}
+		if len(req.Sink) == 0 {
+			req.Sink = h.logger.outputSink()
+		}
+		if req.Level == nil && len(req.TTL) > 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			enc.Encode(levelResponse{Error: "ttl is only supported for level changes"})
+			return
+		}
+
+		var ttl time.Duration
+		if len(req.TTL) > 0 {
+			ttl, err = time.ParseDuration(req.TTL)
+			if err != nil || ttl <= 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				enc.Encode(levelResponse{Error: errors.Errorf("invalid ttl %q", req.TTL).Error()})
+				return
+			}
+		}
+
+		if req.Level != nil {
+			if err := h.setLevel(req.Sink, *req.Level, ttl, r.RemoteAddr); err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				enc.Encode(levelResponse{Error: err.Error()})
+				return
+			}
+		}
+		if req.Levels != nil {
+			h.setLevelSpec(*req.Levels, r.RemoteAddr)
+		}
+
+		res := levelResponse{Sink: req.Sink, TTL: req.TTL, Levels: req.Levels}
+		if req.Level != nil {
+			res.Level = *req.Level
+		} else if level, ok := h.logger.SinkLevel(req.Sink); ok {
+			res.Level = level.Level()
+		}
+		enc.Encode(res)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		enc.Encode(levelResponse{Error: "Only GET and PUT are supported."})
+	}
+}
+
+// setLevel of sink and schedule reverting it to the previous level if ttl is set
+// A pending revert of the same sink is being replaced, keeping its original level
+func (h *levelHandler) setLevel(sink Sink, to zapcore.Level, ttl time.Duration, remote string) error {
+	level, ok := h.logger.SinkLevel(sink)
+	if !ok {
+		return errors.Errorf("sink %q is not configured", sink)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	from := level.Level()
+	original := from
+	if pending, ok := h.reverts[sink]; ok {
+		pending.timer.Stop()
+		original = pending.to
+		delete(h.reverts, sink)
+	}
+
+	h.logger.changeLevel(level, to, "log level changed",
+		zap.String("sink", string(sink)),
+		zap.Stringer("from", from),
+		zap.Stringer("to", to),
+		zap.Duration("ttl", ttl),
+		zap.String("remote", remote),
+	)
+
+	if ttl <= 0 {
+		return nil
+	}
+
+	revert := &levelRevert{to: original}
+	revert.timer = time.AfterFunc(ttl, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		// a newer change replaced this revert
+		if h.reverts[sink] != revert {
+			return
+		}
+		delete(h.reverts, sink)
+		h.logger.changeLevel(level, revert.to, "log level reverted",
+			zap.String("sink", string(sink)),
+			zap.Stringer("from", to),
+			zap.Stringer("to", revert.to),
+		)
+	})
+	h.reverts[sink] = revert
+	return nil
+}
+
+// changeLevel sets level to to and writes the audit entry msg
+// The entry is written while level is still at the more verbose of both levels, so raising the level does not drop it
+func (l *Logger) changeLevel(level zap.AtomicLevel, to zapcore.Level, msg string, fields ...zapcore.Field) {
+	from := level.Level()
+	if to < from {
+		level.SetLevel(to)
+	}
+	if ce := l.Check(auditLevel(from, to), msg); ce != nil {
+		ce.Write(fields...)
+	}
+	if to >= from {
+		level.SetLevel(to)
+	}
+}
+
+// auditLevel returns the level of audit entries for a change between from and to
+// This is Warn, unless the more verbose of both levels is stricter, which is capped at Error as later levels panic or exit
+func auditLevel(from, to zapcore.Level) zapcore.Level {
+	lvl := from
+	if to < lvl {
+		lvl = to
+	}
+	switch {
+	case lvl < zapcore.WarnLevel:
+		return zapcore.WarnLevel
+	case lvl > zapcore.ErrorLevel:
+		return zapcore.ErrorLevel
+	}
+	return lvl
+}
+
+// setLevelSpec replaces the level spec of the logger
+func (h *levelHandler) setLevelSpec(spec LevelSpec, remote string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	from := h.logger.LevelSpec()
+	h.logger.SetLevelSpec(spec)
+	h.logger.Warn("log level spec changed",
+		zap.Stringer("from", from),
+		zap.Stringer("to", spec),
+		zap.String("remote", remote),
+	)
+}
+
+func decodeLevelRequest(r *http.Request) (*levelRequest, error) {
+	var req levelRequest
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if err := r.ParseForm(); err != nil {
+			return nil, errors.Wrap(err, "Request body must be well-formed form data")
+		}
+		if value := r.PostForm.Get("level"); len(value) > 0 {
+			var level zapcore.Level
+			if err := level.Set(value); err != nil {
+				return nil, err
+			}
+			req.Level = &level
+		}
+		if values, ok := r.PostForm["levels"]; ok && len(values) > 0 {
+			var spec LevelSpec
+			if err := spec.Set(values[0]); err != nil {
+				return nil, err
+			}
+			req.Levels = &spec
+		}
+		req.Sink = Sink(r.PostForm.Get("sink"))
+		req.TTL = r.PostForm.Get("ttl")
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, errors.Wrap(err, "Request body must be well-formed JSON")
+	}
+
+	if req.Level == nil && req.Levels == nil {
+		return nil, errors.New("Must specify a logging level.")
+	}
+	return &req, nil
+}
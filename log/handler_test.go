@@ -0,0 +1,242 @@
+package log_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seibert-media/golibs/log"
+	"go.uber.org/zap"
+)
+
+func serveLevel(t *testing.T, h http.Handler, req *http.Request) map[string]interface{} {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var res map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal("response should be json, got:", rec.Body.String())
+	}
+	res["status"] = rec.Code
+	return res
+}
+
+func Test_LevelHandlerGet(t *testing.T) {
+	logger, _ := newTestLogger(t, log.OptSentryDSN("http://test@localhost/test"))
+	h := logger.LevelHandler()
+
+	res := serveLevel(t, h, httptest.NewRequest(http.MethodGet, "/", nil))
+	if res["level"] != "info" {
+		t.Fatal("level should be info, got:", res)
+	}
+	sinks, _ := res["sinks"].(map[string]interface{})
+	if sinks["sentry"] != "error" || sinks["console"] != "info" {
+		t.Fatal("unexpected sinks:", res)
+	}
+
+	res = serveLevel(t, h, httptest.NewRequest(http.MethodGet, "/?sink=sentry", nil))
+	if res["sink"] != "sentry" || res["level"] != "error" {
+		t.Fatal("unexpected sentry level:", res)
+	}
+
+	res = serveLevel(t, h, httptest.NewRequest(http.MethodGet, "/?sink=file", nil))
+	if res["status"] != http.StatusNotFound {
+		t.Fatal("unconfigured sink should return not found, got:", res)
+	}
+}
+
+func Test_LevelHandlerPutJSON(t *testing.T) {
+	logger, buf := newTestLogger(t, log.OptSentryDSN("http://test@localhost/test"))
+	h := logger.LevelHandler()
+
+	req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"level":"debug"}`))
+	res := serveLevel(t, h, req)
+	if res["status"] != http.StatusOK || res["level"] != "debug" {
+		t.Fatal("unexpected response:", res)
+	}
+	if logger.Level.Level() != zap.DebugLevel {
+		t.Fatal("level should be debug, got:", logger.Level.Level())
+	}
+	if !strings.Contains(buf.String(), "log level changed") {
+		t.Fatal("change should be logged, got:", buf.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"level":"warn","sink":"sentry"}`))
+	serveLevel(t, h, req)
+	if level, _ := logger.SinkLevel(log.SinkSentry); level.Level() != zap.WarnLevel {
+		t.Fatal("sentry level should be warn, got:", level.Level())
+	}
+}
+
+func Test_LevelHandlerPutForm(t *testing.T) {
+	logger, _ := newTestLogger(t, log.OptSentryDSN("http://test@localhost/test"))
+	h := logger.LevelHandler()
+
+	form := url.Values{"level": {"warn"}, "sink": {"console"}}
+	req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res := serveLevel(t, h, req)
+	if res["status"] != http.StatusOK {
+		t.Fatal("unexpected response:", res)
+	}
+	if logger.Level.Level() != zap.WarnLevel {
+		t.Fatal("level should be warn, got:", logger.Level.Level())
+	}
+}
+
+func Test_LevelHandlerTTL(t *testing.T) {
+	logger, buf := newTestLogger(t, log.OptSentryDSN("http://test@localhost/test"))
+	h := logger.LevelHandler()
+
+	req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"level":"debug","ttl":"20ms"}`))
+	serveLevel(t, h, req)
+	if logger.Level.Level() != zap.DebugLevel {
+		t.Fatal("level should be debug, got:", logger.Level.Level())
+	}
+
+	reverted := waitFor(func() bool {
+		return strings.Contains(buf.String(), "log level reverted")
+	})
+	if !reverted {
+		t.Fatal("revert should be logged, got:", buf.String())
+	}
+	if logger.Level.Level() != zap.InfoLevel {
+		t.Fatal("level should have been reverted to info, got:", logger.Level.Level())
+	}
+}
+
+func Test_LevelHandlerAuditRaisedLevel(t *testing.T) {
+	logger, buf := newTestLogger(t, log.OptSentryDSN("http://test@localhost/test"))
+	h := logger.LevelHandler()
+
+	serveLevel(t, h, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"level":"warn","ttl":"20ms"}`)))
+	if !strings.Contains(buf.String(), "log level changed") {
+		t.Fatal("raising the level should be logged, got:", buf.String())
+	}
+	reverted := waitFor(func() bool {
+		return strings.Contains(buf.String(), "log level reverted")
+	})
+	if !reverted {
+		t.Fatal("revert should be logged, got:", buf.String())
+	}
+	if logger.Level.Level() != zap.InfoLevel {
+		t.Fatal("level should have been reverted to info, got:", logger.Level.Level())
+	}
+}
+
+func Test_LevelHandlerAuditError(t *testing.T) {
+	logger, buf := newTestLogger(t)
+	h := logger.LevelHandler()
+
+	serveLevel(t, h, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"level":"error","ttl":"20ms"}`)))
+	if !strings.Contains(buf.String(), "log level changed") {
+		t.Fatal("raising the level to error should be logged, got:", buf.String())
+	}
+	reverted := waitFor(func() bool {
+		return strings.Contains(buf.String(), "log level reverted")
+	})
+	if !reverted {
+		t.Fatal("revert should be logged, got:", buf.String())
+	}
+
+	serveLevel(t, h, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"level":"error"}`)))
+	serveLevel(t, h, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"level":"fatal"}`)))
+	if strings.Count(buf.String(), "log level changed") != 3 {
+		t.Fatal("raising the level above warn should be logged, got:", buf.String())
+	}
+}
+
+func Test_LevelHandlerNop(t *testing.T) {
+	res := serveLevel(t, log.From(context.Background()).LevelHandler(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if res["status"] != http.StatusNotFound {
+		t.Fatal("nop logger should respond with not found, got:", res)
+	}
+}
+
+func Test_LevelHandlerTTLReplaced(t *testing.T) {
+	logger, _ := newTestLogger(t, log.OptSentryDSN("http://test@localhost/test"))
+	h := logger.LevelHandler()
+
+	serveLevel(t, h, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"level":"debug","ttl":"20ms"}`)))
+	serveLevel(t, h, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"level":"warn"}`)))
+	time.Sleep(50 * time.Millisecond)
+	if logger.Level.Level() != zap.WarnLevel {
+		t.Fatal("newer change should cancel the revert, got:", logger.Level.Level())
+	}
+}
+
+func Test_LevelHandlerInvalid(t *testing.T) {
+	logger, _ := newTestLogger(t, log.OptSentryDSN("http://test@localhost/test"))
+	h := logger.LevelHandler()
+
+	tests := map[string]int{
+		`{"level":"verbose"}`:           http.StatusBadRequest,
+		`{}`:                            http.StatusBadRequest,
+		`{"level":"debug","ttl":"x"}`:   http.StatusBadRequest,
+		`{"level":"debug","sink":"db"}`: http.StatusNotFound,
+	}
+	for body, status := range tests {
+		res := serveLevel(t, h, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body)))
+		if res["status"] != status {
+			t.Fatalf("body %s should return %d, got: %v", body, status, res)
+		}
+	}
+
+	res := serveLevel(t, h, httptest.NewRequest(http.MethodPost, "/", nil))
+	if res["status"] != http.StatusMethodNotAllowed {
+		t.Fatal("post should not be allowed, got:", res)
+	}
+}
+
+func Test_LevelHandlerTTLKeepsOriginal(t *testing.T) {
+	logger, buf := newTestLogger(t, log.OptSentryDSN("http://test@localhost/test"))
+	h := logger.LevelHandler()
+
+	serveLevel(t, h, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"level":"warn","ttl":"1h"}`)))
+	serveLevel(t, h, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"level":"debug","ttl":"20ms"}`)))
+	reverted := waitFor(func() bool {
+		return strings.Contains(buf.String(), "log level reverted")
+	})
+	if !reverted || logger.Level.Level() != zap.InfoLevel {
+		t.Fatal("level should have been reverted to the original info, got:", logger.Level.Level())
+	}
+}
+
+func Test_LevelHandlerLevelSpec(t *testing.T) {
+	logger, buf := newTestLogger(t, log.OptSentryDSN("http://test@localhost/test"))
+	h := logger.LevelHandler()
+
+	req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"levels":"db=debug,*=warn"}`))
+	res := serveLevel(t, h, req)
+	if res["status"] != http.StatusOK || res["levels"] != "*=warn,db=debug" {
+		t.Fatal("unexpected response:", res)
+	}
+	if logger.LevelSpec().String() != "*=warn,db=debug" {
+		t.Fatal("level spec should be changed, got:", logger.LevelSpec())
+	}
+	if !strings.Contains(buf.String(), "log level spec changed") {
+		t.Fatal("change should be logged, got:", buf.String())
+	}
+
+	form := url.Values{"levels": {""}}
+	req = httptest.NewRequest(http.MethodPut, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	serveLevel(t, h, req)
+	if len(logger.LevelSpec()) != 0 {
+		t.Fatal("level spec should be removed, got:", logger.LevelSpec())
+	}
+
+	res = serveLevel(t, h, httptest.NewRequest(http.MethodGet, "/", nil))
+	if levels, ok := res["levels"]; !ok || levels != "" {
+		t.Fatal("level spec should be returned, got:", res)
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"levels":"db=debug","ttl":"1m"}`))
+	if res := serveLevel(t, h, req); res["status"] != http.StatusBadRequest {
+		t.Fatal("ttl without level should be rejected, got:", res)
+	}
+}
@@ -0,0 +1,108 @@
+package log_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getsentry/raven-go"
+	"github.com/seibert-media/golibs/log"
+)
+
+// newTestLogger builds a local logger writing to the returned buffer, opts are applied after these defaults
+func newTestLogger(t *testing.T, opts ...log.Option) (*log.Logger, *syncBuffer) {
+	buf := &syncBuffer{}
+	opts = append([]log.Option{
+		log.OptLocal(true),
+		log.OptOutput(buf),
+	}, opts...)
+	logger, err := log.NewWithOptions(opts...)
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+	return logger, buf
+}
+
+// syncBuffer allows reading the log output while other goroutines are logging
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitFor polls condition until it returns true or a second has passed
+func waitFor(condition func() bool) bool {
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return true
+}
+
+// recordingReporter is an ErrorReporter storing all packets instead of sending them
+type recordingReporter struct {
+	mu      sync.Mutex
+	packets []*raven.Packet
+	release string
+}
+
+func (r *recordingReporter) Capture(packet *raven.Packet, done func(error)) {
+	r.mu.Lock()
+	r.packets = append(r.packets, packet)
+	r.mu.Unlock()
+	done(nil)
+}
+
+func (r *recordingReporter) Flush(ctx context.Context) error { return nil }
+func (r *recordingReporter) Close() error                    { return nil }
+func (r *recordingReporter) SetEnvironment(string)           {}
+
+func (r *recordingReporter) SetRelease(release string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.release = release
+}
+
+func (r *recordingReporter) Release() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.release
+}
+
+func (r *recordingReporter) Packets() []*raven.Packet {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*raven.Packet(nil), r.packets...)
+}
+
+func decodeEntries(t *testing.T, out fmt.Stringer) []map[string]interface{} {
+	var entries []map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(out.String()))
+	for dec.More() {
+		var entry map[string]interface{}
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatal("decoding entry failed with:", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
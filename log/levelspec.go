@@ -0,0 +1,183 @@
+package log
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LevelSpecAll is the logger name matching all loggers without a more specific rule
+const LevelSpecAll = "*"
+
+// LevelSpec maps logger names to levels, e.g. parsed from "db=debug,http=warn,*=info"
+// A rule applies to the named logger and all its children, so "db" also matches "db.pool".
+// Rules are relative to the output level at the time they are set: with the output at Info, "db=debug" lowers the levels
+// of the console, stackdriver and file sinks by one for the db logger. Runtime level changes and stricter sink levels
+// therefore still apply, sentry is not affected.
+// Logger.LevelSpec and the LevelHandler report the effective level of each rule at the current output level,
+// so after raising the output level to Error the rule "db=debug" is reported as "db=warn"
+type LevelSpec map[string]zapcore.Level
+
+// ParseLevelSpec parses a comma separated list of name=level rules
+func ParseLevelSpec(spec string) (LevelSpec, error) {
+	levels := make(LevelSpec)
+	for _, rule := range strings.Split(spec, ",") {
+		rule = strings.TrimSpace(rule)
+		if len(rule) == 0 {
+			continue
+		}
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 {
+			return nil, errors.Errorf("invalid level rule %q, expected name=level", rule)
+		}
+		var level zapcore.Level
+		if err := level.Set(strings.TrimSpace(parts[1])); err != nil {
+			return nil, errors.Wrapf(err, "invalid level rule %q", rule)
+		}
+		levels[strings.TrimSpace(parts[0])] = level
+	}
+	return levels, nil
+}
+
+// String formats the LevelSpec in the format accepted by ParseLevelSpec
+func (s LevelSpec) String() string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rules := make([]string, 0, len(names))
+	for _, name := range names {
+		rules = append(rules, name+"="+s[name].String())
+	}
+	return strings.Join(rules, ",")
+}
+
+// Set implements flag.Value
+func (s *LevelSpec) Set(value string) error {
+	spec, err := ParseLevelSpec(value)
+	if err != nil {
+		return err
+	}
+	*s = spec
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (s LevelSpec) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (s *LevelSpec) UnmarshalText(text []byte) error {
+	return s.Set(string(text))
+}
+
+// Level returns the level of the most specific rule matching name
+func (s LevelSpec) Level(name string) (zapcore.Level, bool) {
+	for len(name) > 0 {
+		if level, ok := s[name]; ok {
+			return level, true
+		}
+		i := strings.LastIndex(name, ".")
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+	level, ok := s[LevelSpecAll]
+	return level, ok
+}
+
+// levelRules is the immutable state of a LevelSpec shared between all derived cores
+type levelRules struct {
+	spec LevelSpec
+	// min is the most verbose level of all rules
+	min zapcore.Level
+	// base is the output level the rules are relative to
+	base zapcore.Level
+}
+
+func newLevelRules(spec LevelSpec, base zapcore.Level) *levelRules {
+	rules := &levelRules{spec: make(LevelSpec, len(spec)), min: zapcore.FatalLevel, base: base}
+	for name, level := range spec {
+		rules.spec[name] = level
+		if level < rules.min {
+			rules.min = level
+		}
+	}
+	return rules
+}
+
+// shift returns level moved by the distance of rule to the base level, limited to the valid levels
+func (r *levelRules) shift(level, rule zapcore.Level) zapcore.Level {
+	shifted := int(level) + int(rule) - int(r.base)
+	if shifted < int(zapcore.DebugLevel) {
+		return zapcore.DebugLevel
+	}
+	if shifted > int(zapcore.FatalLevel) {
+		return zapcore.FatalLevel
+	}
+	return zapcore.Level(shifted)
+}
+
+// levelSpecValue holds the current levelRules and can be updated at runtime
+type levelSpecValue struct {
+	v atomic.Value
+	// output is the level of the output sink the rules are relative to
+	output zap.AtomicLevel
+}
+
+func newLevelSpecValue(spec LevelSpec, output zap.AtomicLevel) *levelSpecValue {
+	value := &levelSpecValue{output: output}
+	value.store(spec)
+	return value
+}
+
+func (v *levelSpecValue) load() *levelRules {
+	return v.v.Load().(*levelRules)
+}
+
+// store replaces the rules, relative to the current output level
+func (v *levelSpecValue) store(spec LevelSpec) {
+	v.v.Store(newLevelRules(spec, v.output.Level()))
+}
+
+// effective returns the rules shifted to the current output level
+func (v *levelSpecValue) effective() LevelSpec {
+	rules := v.load()
+	current := v.output.Level()
+	spec := make(LevelSpec, len(rules.spec))
+	for name, level := range rules.spec {
+		spec[name] = rules.shift(current, level)
+	}
+	return spec
+}
+
+// LevelSpec returns the current per logger name levels, each at the level it is effective at for the output
+func (l *Logger) LevelSpec() LevelSpec {
+	if l.levelSpec == nil {
+		return LevelSpec{}
+	}
+	return l.levelSpec.effective()
+}
+
+// SetLevelSpec replaces the per logger name levels for the Logger and all loggers derived from it
+// The rules are relative to the current output level, so they are effective as given until the output level changes
+func (l *Logger) SetLevelSpec(spec LevelSpec) {
+	if l.levelSpec == nil {
+		return
+	}
+	l.levelSpec.store(spec)
+}
+
+// SetLevelSpec of the logger stored in ctx
+func SetLevelSpec(ctx context.Context, spec LevelSpec) {
+	From(ctx).SetLevelSpec(spec)
+}
@@ -0,0 +1,179 @@
+package log_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/seibert-media/golibs/log"
+	"go.uber.org/zap"
+)
+
+func Test_ParseLevelSpec(t *testing.T) {
+	spec, err := log.ParseLevelSpec("db=debug, http=warn,*=info")
+	if err != nil {
+		t.Fatal("parsing spec failed with:", err)
+	}
+	if len(spec) != 3 || spec["db"] != zap.DebugLevel || spec["http"] != zap.WarnLevel || spec["*"] != zap.InfoLevel {
+		t.Fatal("unexpected spec:", spec)
+	}
+	if spec.String() != "*=info,db=debug,http=warn" {
+		t.Fatal("unexpected spec string:", spec.String())
+	}
+
+	for _, invalid := range []string{"db", "db=verbose", "=debug"} {
+		if _, err := log.ParseLevelSpec(invalid); err == nil {
+			t.Fatalf("parsing %q should have returned error", invalid)
+		}
+	}
+}
+
+func Test_LevelSpecLevel(t *testing.T) {
+	spec := log.LevelSpec{"db": zap.DebugLevel, "db.pool": zap.ErrorLevel}
+	tests := map[string]bool{
+		"db":           true,
+		"db.query":     true,
+		"db.pool":      true,
+		"db.pool.conn": true,
+		"http":         false,
+		"":             false,
+	}
+	for name, found := range tests {
+		if _, ok := spec.Level(name); ok != found {
+			t.Fatalf("rule for %q found=%t, expected %t", name, ok, found)
+		}
+	}
+	if level, _ := spec.Level("db.pool.conn"); level != zap.ErrorLevel {
+		t.Fatal("most specific rule should win, got:", level)
+	}
+
+	spec[log.LevelSpecAll] = zap.WarnLevel
+	if level, ok := spec.Level("http"); !ok || level != zap.WarnLevel {
+		t.Fatal("wildcard rule should match, got:", level)
+	}
+}
+
+func Test_NamedLevels(t *testing.T) {
+	var buf bytes.Buffer
+	spec, _ := log.ParseLevelSpec("db=debug,http=warn")
+	logger, err := log.NewWithOptions(
+		log.OptLocal(true),
+		log.OptOutput(&buf),
+		log.OptLevelSpec(spec),
+	)
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+
+	logger.Named("db").Debug("db debug")
+	logger.Named("db").Named("pool").Debug("pool debug")
+	logger.Named("http").Info("http info")
+	logger.Named("http").Warn("http warn")
+	logger.Named("other").Info("other info")
+	logger.Debug("root debug")
+
+	out := buf.String()
+	for _, msg := range []string{"db debug", "pool debug", "http warn", "other info"} {
+		if !strings.Contains(out, msg) {
+			t.Fatalf("output should contain %q, got: %s", msg, out)
+		}
+	}
+	for _, msg := range []string{"http info", "root debug"} {
+		if strings.Contains(out, msg) {
+			t.Fatalf("output should not contain %q, got: %s", msg, out)
+		}
+	}
+}
+
+func Test_SetLevelSpec(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := log.NewWithOptions(log.OptLocal(true), log.OptOutput(&buf))
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+	ctx := logger.WithFields(zap.String("test", "test")).To(context.Background())
+	db := log.From(ctx).Named("db")
+
+	db.Debug("before")
+	log.SetLevelSpec(ctx, log.LevelSpec{"db": zap.DebugLevel, "*": zap.ErrorLevel})
+	db.Debug("after")
+	logger.Warn("silenced")
+
+	if strings.Contains(buf.String(), "before") || !strings.Contains(buf.String(), "after") {
+		t.Fatal("level spec should apply at runtime, got:", buf.String())
+	}
+	if strings.Contains(buf.String(), "silenced") {
+		t.Fatal("wildcard rule should apply to unnamed logger, got:", buf.String())
+	}
+	if logger.LevelSpec().String() != "*=error,db=debug" {
+		t.Fatal("unexpected level spec:", logger.LevelSpec())
+	}
+
+	log.NewNop().SetLevelSpec(log.LevelSpec{"db": zap.DebugLevel})
+}
+
+func Test_LevelSpecWithSinkLevels(t *testing.T) {
+	var buf bytes.Buffer
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	spec, _ := log.ParseLevelSpec("db=debug,*=info")
+	logger, err := log.NewWithOptions(
+		log.OptLocal(true),
+		log.OptOutput(&buf),
+		log.OptLevelSpec(spec),
+		log.OptFile(log.FileConfig{Path: filepath.Join(dir, "app.log")}),
+		log.OptSinkLevel(log.SinkFile, zap.NewAtomicLevelAt(zap.WarnLevel)),
+	)
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+
+	logger.Named("db").Debug("db debug")
+	logger.Named("db").Info("db info")
+	logger.Debug("root debug")
+	logger.SetLevel(zap.DebugLevel)
+	logger.Debug("raised debug")
+	logger.Sync()
+
+	out := buf.String()
+	for _, msg := range []string{"db debug", "db info", "raised debug"} {
+		if !strings.Contains(out, msg) {
+			t.Fatalf("output should contain %q, got: %s", msg, out)
+		}
+	}
+	if strings.Contains(out, "root debug") {
+		t.Fatal("root debug should only be printed after raising the level, got:", out)
+	}
+
+	file, err := ioutil.ReadFile(filepath.Join(dir, "app.log"))
+	if err != nil {
+		t.Fatal("reading log file failed with:", err)
+	}
+	if strings.Contains(string(file), "db debug") || !strings.Contains(string(file), "db info") {
+		t.Fatal("rules should be relative to the stricter file level, got:", string(file))
+	}
+}
+
+func Test_LevelSpecEffective(t *testing.T) {
+	logger, buf := newTestLogger(t, log.OptLevelSpec(log.LevelSpec{"db": zap.DebugLevel}))
+	db := logger.Named("db")
+
+	logger.SetLevel(zap.ErrorLevel)
+	if logger.LevelSpec().String() != "db=warn" {
+		t.Fatal("level spec should report the effective level of the rule, got:", logger.LevelSpec())
+	}
+	db.Info("shifted")
+	db.Warn("effective")
+	if strings.Contains(buf.String(), "shifted") || !strings.Contains(buf.String(), "effective") {
+		t.Fatal("rule should be shifted with the output level, got:", buf.String())
+	}
+
+	logger.SetLevelSpec(log.LevelSpec{"db": zap.DebugLevel})
+	db.Debug("set at error")
+	if !strings.Contains(buf.String(), "set at error") || logger.LevelSpec().String() != "db=debug" {
+		t.Fatal("rules should be relative to the output level when set, got:", logger.LevelSpec(), buf.String())
+	}
+}
@@ -3,10 +3,11 @@ package log
 import (
 	"context"
 	"os"
+	"time"
 
 	"github.com/blendle/zapdriver"
 	"github.com/getsentry/raven-go"
-	"github.com/tchap/zapext/zapsentry"
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -14,10 +15,23 @@ import (
 // Logger implements Context
 type Logger struct {
 	*zap.Logger
+	// Reporter the sentry sink sends events to, nil if reporting is disabled
+	Reporter ErrorReporter
+	// Sentry is the client of the raven reporter, nil for other reporters
+	// Deprecated: use Reporter or the Logger methods instead
 	Sentry *raven.Client
+	File   *RotatingFile
 	Level  zap.AtomicLevel
 
-	dsn   string
+	levels    map[Sink]zap.AtomicLevel
+	levelSpec *levelSpecValue
+	meta      sentryMeta
+
+	sentryState *sentryState
+	spool       *sentrySpool
+
+	breadcrumbLimit int
+
 	nop   bool
 	local bool
 }
@@ -53,6 +67,12 @@ func SetLevel(ctx context.Context, to zapcore.Level) {
 	From(ctx).Level.SetLevel(to)
 }
 
+// WithLevel returns a context whose logger additionally prints all entries at level and above
+// Other goroutines using the parent logger are not affected, entries are not reported to sentry below its own level
+func WithLevel(ctx context.Context, level zapcore.Level) context.Context {
+	return WithLogger(ctx, From(ctx).WithLevel(level))
+}
+
 // WithFieldsOverwrite adds all passed in zap fields to the Logger stored in ctx and overwrites it for further use
 // WARNING: This might kill thread safety - Experimental and bad practice - DO NOT USE!
 func WithFieldsOverwrite(ctx context.Context, fields ...zapcore.Field) *Logger {
@@ -66,54 +86,125 @@ func WithFieldsOverwrite(ctx context.Context, fields ...zapcore.Field) *Logger {
 // If no sentry dsn is provided, the sentry encoding is disabled
 // If local is true, logs will be provided in a human readable format, false will print stackdriver conformant logs as json
 func New(dsn string, local bool) (*Logger, error) {
-	level := zap.NewAtomicLevelAt(zap.InfoLevel)
-	return NewWithLevel(dsn, local, level)
+	return NewWithOptions(OptSentryDSN(dsn), OptLocal(local))
 }
 
 // NewWithLevel builds a Logger instance with an optional sentry key and the predefined level.
 // If no sentry dsn is provided, the sentry encoding is disabled
 // If local is true, logs will be provided in a human readable format, false will print stackdriver conformant logs as json
-func NewWithLevel(dsn string, local bool, level zap.AtomicLevel) (*Logger, error) {
+// Additional options, e.g. OptErrorReporting, are applied afterwards
+func NewWithLevel(dsn string, local bool, level zap.AtomicLevel, opts ...Option) (*Logger, error) {
+	return NewWithOptions(append([]Option{OptSentryDSN(dsn), OptLocal(local), OptAtomicLevel(level)}, opts...)...)
+}
+
+// NewWithOptions builds a Logger instance configured by the passed in options.
+// Without any options, the logger prints stackdriver conformant json at Info level and does not report to sentry
+func NewWithOptions(opts ...Option) (*Logger, error) {
 	var (
-		cores  []zapcore.Core
-		sentry *raven.Client
+		o    = newOptions(opts...)
+		meta = sentryMeta{
+			environment:   o.environment,
+			serverName:    o.serverName,
+			dist:          o.dist,
+			sharedRelease: atomic.NewString(o.release),
+		}
+		levels = make(map[Sink]zap.AtomicLevel)
+		sinks  []sinkCore
+		state  *sentryState
+		file   *RotatingFile
 		err    error
 	)
 
-	if len(dsn) > 0 {
-		sentry, err = raven.New(dsn)
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+
+	// the file is opened before starting the reporter, so nothing needs to be stopped if opening fails
+	if o.file != nil {
+		config := *o.file
+		if config.ErrorOutput == nil {
+			config.ErrorOutput = o.errorSink()
+		}
+		file, err = NewRotatingFile(config)
 		if err != nil {
 			return nil, err
 		}
-		cores = append(cores, zapsentry.NewCore(zapcore.ErrorLevel, sentry))
 	}
 
-	if local {
-		cores = append(cores, buildConsoleLogger(level))
+	reporter, sentry, spool, err := newReporter(o)
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		return nil, err
+	}
+	if reporter != nil {
+		if len(o.environment) > 0 {
+			reporter.SetEnvironment(o.environment)
+		}
+		if len(o.release) > 0 {
+			reporter.SetRelease(o.release)
+		}
+		state = newSentryState(reporter, newSentryLimiter(o.sentrySampleRate, o.sentryRateLimit, o.sentryRateWindow), o.beforeSend)
+		level := o.sinkLevel(SinkSentry)
+		sinks = append(sinks, sinkCore{
+			sink:  SinkSentry,
+			level: level,
+			core:  newSentryCore(state, level, o.breadcrumbLevel, meta),
+		})
+	}
+
+	if o.local {
+		sinks = append(sinks, sinkCore{
+			sink:  SinkConsole,
+			level: o.level,
+			core:  buildConsoleLogger(allLevels, o.output(os.Stdout)),
+		})
 	} else {
-		stackdriver := zapdriver.NewProductionConfig()
-		stackdriver.Level = level
+		sinks = append(sinks, sinkCore{
+			sink:  SinkStackdriver,
+			level: o.level,
+			core:  buildStackdriverLogger(allLevels, o.output(os.Stderr), o.errorReportingService, meta),
+		})
+	}
 
-		l, err := stackdriver.Build()
-		if err != nil {
-			return nil, err
-		}
-		cores = append(cores, l.Core())
+	if file != nil {
+		sinks = append(sinks, sinkCore{
+			sink:  SinkFile,
+			level: o.sinkLevel(SinkFile),
+			core:  buildFileLogger(allLevels, file),
+		})
+	}
+
+	for _, s := range sinks {
+		levels[s.sink] = s.level
 	}
 
-	logger := zap.New(zapcore.NewTee(cores...)).WithOptions(
+	spec := newLevelSpecValue(o.levelSpec, o.level)
+	logger := zap.New(newRoutingCore(spec, sinks...)).WithOptions(
 		zap.AddCaller(),
 		zap.AddStacktrace(zap.ErrorLevel),
-	)
+		zap.ErrorOutput(o.errorSink()),
+	).WithOptions(o.zapOptions...)
 
 	return &Logger{
-		Logger: logger,
-		Sentry: sentry,
-		Level:  level,
+		Logger:   logger,
+		Reporter: reporter,
+		Sentry:   sentry,
+		File:     file,
+		Level:    o.level,
+
+		levels:    levels,
+		levelSpec: spec,
+		meta:      meta,
+
+		sentryState: state,
+		spool:       spool,
+
+		breadcrumbLimit: o.breadcrumbLimit,
 
-		dsn:   dsn,
 		nop:   false,
-		local: local,
+		local: o.local,
 	}, nil
 }
 
@@ -132,21 +223,36 @@ func NewNop() *Logger {
 }
 
 // WithFields wrapper around zap.With
+// The returned Logger shares its cores, level and sentry client with the parent
 func (l *Logger) WithFields(fields ...zapcore.Field) *Logger {
 	if l.nop {
 		return l
 	}
-	log, err := NewWithLevel(l.dsn, l.local, l.Level)
-	if err != nil {
-		l.Error("creating new logger", zap.Error(err))
+	log := l.clone()
+	log.Logger = l.Logger.With(fields...)
+	return log
+}
+
+// Named wrapper around zap.Named
+// The returned Logger shares its cores, level and sentry client with the parent
+func (l *Logger) Named(name string) *Logger {
+	if l.nop {
 		return l
 	}
+	log := l.clone()
+	log.Logger = l.Logger.Named(name)
+	return log
+}
 
-	if l.Sentry != nil {
-		log.Sentry.SetRelease(l.Sentry.Release())
+// WithLevel returns a new logger additionally printing all entries at level and above
+// This only affects the returned logger and the loggers derived from it
+func (l *Logger) WithLevel(level zapcore.Level) *Logger {
+	if l.nop {
+		return l
 	}
-	log.Logger = l.Logger.With(fields...)
-	return log
+	return l.withRouting(func(c *routingCore) *routingCore {
+		return c.withOverride(level)
+	})
 }
 
 // IsNop returns the nop status of Logger (mainly for testing)
@@ -159,27 +265,38 @@ func (l *Logger) To(ctx context.Context) context.Context {
 	return WithLogger(ctx, l)
 }
 
-// WithRelease returns a new logger updating the internal sentry client with release info
-// This should be the first change to the logger (before adding fields) as otherwise the change
-// might not be persisted
-func (l *Logger) WithRelease(info string) *Logger {
-	if l.nop {
-		return l
-	}
-	l.Sentry.SetRelease(info)
-	return l
-}
-
 // SetLevel of the underlying zap.Logger
 func (l *Logger) SetLevel(to zapcore.Level) {
 	l.Level.SetLevel(to)
 }
 
-func buildConsoleLogger(level zap.AtomicLevel) zapcore.Core {
-	stdout := zapcore.Lock(os.Stdout)
+// withRouting returns a new logger whose routingCore is derived by opt
+func (l *Logger) withRouting(opt routingOption) *Logger {
+	log := l.clone()
+	log.Logger = l.Logger.With(routingField(opt))
+	return log
+}
+
+// clone returns a shallow copy of the Logger for deriving new instances
+func (l *Logger) clone() *Logger {
+	log := *l
+	return &log
+}
 
+func buildConsoleLogger(level zapcore.LevelEnabler, out zapcore.WriteSyncer) zapcore.Core {
 	config := zap.NewDevelopmentEncoderConfig()
 	encoder := zapcore.NewConsoleEncoder(config)
 
-	return zapcore.NewCore(encoder, stdout, level)
+	return newStackdriverCore(zapcore.NewCore(encoder, out, level), true)
+}
+
+// buildStackdriverLogger mirrors zapdriver.NewProductionConfig while writing to out
+// Errors carrying a stack trace add it as stack_trace field for stackdriver error reporting,
+// with a service all entries at Error and above are marked as reported errors
+func buildStackdriverLogger(level zapcore.LevelEnabler, out zapcore.WriteSyncer, service string, meta sentryMeta) zapcore.Core {
+	config := zapdriver.NewProductionEncoderConfig()
+	encoder := zapcore.NewJSONEncoder(config)
+
+	core := newStackdriverCore(newStackTraceCore(zapcore.NewCore(encoder, out, level), service, meta), false)
+	return zapcore.NewSampler(core, time.Second, 100, 100)
 }
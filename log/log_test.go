@@ -3,19 +3,23 @@ package log_test
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
-	"fmt"
-	"io"
-	"os"
 	"strings"
 	"testing"
 
+	"github.com/getsentry/raven-go"
 	"github.com/seibert-media/golibs/log"
+	"github.com/seibert-media/golibs/logtest/sentrytest"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 func Test_NewWithSentry(t *testing.T) {
-	logger, err := log.New("http://test@localhost/test", true)
+	server := sentrytest.NewServer()
+	defer server.Close()
+
+	logger, err := log.New(server.DSN(), true)
 	if err != nil {
 		t.Fatal("creating logger failed with:", err)
 	}
@@ -28,6 +32,12 @@ func Test_NewWithSentry(t *testing.T) {
 	if logger.Sentry == nil {
 		t.Fatal("sentry is nil")
 	}
+
+	logger.Error("test", zap.Error(errors.New("failed")))
+	event := server.AssertEvent(t, "test", raven.ERROR)
+	if len(event.Raw["exception"]) == 0 {
+		t.Fatal("error should be reported as exception, got:", event)
+	}
 }
 
 func Test_NewWithoutSentry(t *testing.T) {
@@ -243,39 +253,32 @@ func Test_NewNop(t *testing.T) {
 func Test_SetRelease(t *testing.T) {
 	logger := log.NewNop()
 	logger = logger.WithRelease("test")
-	if logger.Sentry.Release() != "" {
-		t.Fatal("noop logger shouldn't have release info", logger.Sentry.Release())
+	if logger.Release() != "" {
+		t.Fatal("noop logger shouldn't have release info", logger.Release())
 	}
 
 	logger, _ = log.New("http://test@localhost/test", true)
 	logger = logger.WithRelease("test")
-	if logger.Sentry.Release() != "test" {
-		t.Fatal("sentry release info not set, is:", logger.Sentry.Release())
+	if logger.Release() != "test" || logger.Sentry.Release() != "test" {
+		t.Fatal("release info not set, is:", logger.Release(), logger.Sentry.Release())
 	}
 }
 
 func Test_SetLevel(t *testing.T) {
-	out := make(chan string)
-
-	capture := &stdCapture{}
-	capture.capture(out)
-	logger, _ := log.New("", true)
+	var buf bytes.Buffer
+	logger, _ := log.NewWithOptions(log.OptLocal(true), log.OptOutput(&buf))
 	logger.Debug("test")
-	capture.finish()
-	msg := <-out
-	if len(msg) > 0 {
-		t.Fatal("logger should not print message to stdout, got:", msg)
+	if buf.Len() > 0 {
+		t.Fatal("logger should not print message to output, got:", buf.String())
 	}
 
-	capture = &stdCapture{}
-	capture.capture(out)
-	logger, _ = log.New("", true)
+	buf.Reset()
+	logger, _ = log.NewWithOptions(log.OptLocal(true), log.OptOutput(&buf))
 	logger.SetLevel(zap.DebugLevel)
 	logger.Debug("test2")
-	capture.finish()
-	msg = <-out
+	msg := buf.String()
 	if len(msg) < 1 {
-		t.Fatal("logger should print message to stdout, got:", msg)
+		t.Fatal("logger should print message to output, got:", msg)
 	}
 	if !strings.Contains(msg, "DEBUG") {
 		t.Fatal("message should be DEBUG, got:", msg)
@@ -283,50 +286,159 @@ func Test_SetLevel(t *testing.T) {
 }
 
 func Test_CtxSetLevel(t *testing.T) {
-	out := make(chan string)
-
-	capture := &stdCapture{}
-	capture.capture(out)
-	logger, _ := log.New("", true)
+	var buf bytes.Buffer
+	logger, _ := log.NewWithOptions(log.OptLocal(true), log.OptOutput(&buf))
 	ctx := logger.To(context.Background())
 	logger.WithFields(zap.String("test", "test"))
 	log.SetLevel(ctx, zap.DebugLevel)
 	logger.WithFields(zap.String("test", "test"))
 	logger.Debug("test")
-	capture.finish()
-	msg := <-out
+	msg := buf.String()
 	if len(msg) < 1 {
-		t.Fatal("logger should print message to stdout, got:", msg)
+		t.Fatal("logger should print message to output, got:", msg)
 	}
 	if !strings.Contains(msg, "DEBUG") {
 		t.Fatal("message should be DEBUG, got:", msg)
 	}
 }
 
-type stdCapture struct {
-	stdout *os.File
-	r, w   *os.File
-	c      chan string
+func Test_CtxWithLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := log.NewWithOptions(
+		log.OptLocal(true),
+		log.OptOutput(&buf),
+		log.OptSentryDSN("http://test@localhost/test"),
+	)
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+	ctx := log.WithLevel(logger.To(context.Background()), zap.DebugLevel)
+	ctx = log.WithFields(ctx, zap.String("test", "test"))
+
+	log.From(ctx).Debug("scoped")
+	logger.Debug("parent")
+
+	if !strings.Contains(buf.String(), "scoped") {
+		t.Fatal("scoped logger should print debug, got:", buf.String())
+	}
+	if strings.Contains(buf.String(), "parent") {
+		t.Fatal("parent logger should not print debug, got:", buf.String())
+	}
+	if logger.Level.Level() != zap.InfoLevel {
+		t.Fatal("shared level should not change, got:", logger.Level.Level())
+	}
+	if level, _ := logger.SinkLevel(log.SinkSentry); level.Enabled(zap.DebugLevel) {
+		t.Fatal("sentry level should not change")
+	}
+}
+
+func Test_WithLevelWrappedCore(t *testing.T) {
+	var hooks int
+	reporter := &recordingReporter{}
+	logger, buf := newTestLogger(t, log.OptErrorReporter(reporter),
+		log.OptZapOptions(zap.Hooks(func(zapcore.Entry) error {
+			hooks++
+			return nil
+		})),
+	)
+	ctx := log.WithLevel(logger.To(context.Background()), zap.DebugLevel)
+	ctx = log.WithSentryUser(ctx, "1", "", "")
+	log.From(ctx).Debug("scoped")
+	log.From(ctx).WithReleaseOverride("v2").Error("failed")
+	logger.Sync()
+
+	if !strings.Contains(buf.String(), "scoped") {
+		t.Fatal("scoped logger should print debug despite the wrapped core, got:", buf.String())
+	}
+	if hooks != 2 {
+		t.Fatal("hooks should be called for every entry, got:", hooks)
+	}
+	packet := reporter.Packets()[0]
+	if user, ok := interfaceOf(packet, "user").(*raven.User); !ok || user.ID != "1" || packet.Release != "v2" {
+		t.Fatal("user and release should be reported despite the wrapped core, got:", packet.Interfaces, packet.Release)
+	}
 }
 
-func (s *stdCapture) capture(to chan string) {
-	s.stdout = os.Stdout
-	r, w, err := os.Pipe()
+func Test_WithLevelNop(t *testing.T) {
+	logger := log.NewNop().WithLevel(zap.DebugLevel)
+	if !logger.IsNop() {
+		t.Fatal("nop logger should stay nop")
+	}
+}
+
+func Test_OutputStackdriver(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := log.NewWithOptions(log.OptLocal(false), log.OptOutput(&buf))
 	if err != nil {
-		panic(fmt.Sprint("creating pipe failed with:", err))
+		t.Fatal("creating logger failed with:", err)
+	}
+	logger.WithFields(zap.String("test", "value")).Warn("message")
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal("output should be json, got:", buf.String())
 	}
-	os.Stdout = w
-	s.r, s.w = r, w
+	if entry["severity"] != "WARNING" {
+		t.Fatal("severity should be WARNING, got:", entry["severity"])
+	}
+	if entry["message"] != "message" || entry["test"] != "value" {
+		t.Fatal("entry is missing message or fields, got:", entry)
+	}
+}
 
-	go func() {
-		var buf bytes.Buffer
-		io.Copy(&buf, r)
-		to <- buf.String()
-	}()
+func Test_WithFieldsSharesSentry(t *testing.T) {
+	logger, err := log.New("http://test@localhost/test", true)
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+	derived := logger.WithFields(zap.String("test", "test"))
+	if derived == logger {
+		t.Fatal("derived logger should be a new instance")
+	}
+	if derived.Sentry != logger.Sentry {
+		t.Fatal("derived logger should share the sentry client")
+	}
+	if derived.Level != logger.Level {
+		t.Fatal("derived logger should share the level")
+	}
+	logger.SetLevel(zap.DebugLevel)
+	if !derived.Core().Enabled(zap.DebugLevel) {
+		t.Fatal("level change should apply to derived logger")
+	}
 }
 
-func (s *stdCapture) finish() {
-	s.w.Close()
-	os.Stdout = s.stdout
+func BenchmarkWithFields(b *testing.B) {
+	logger, err := log.New("http://test@localhost/test", true)
+	if err != nil {
+		b.Fatal("creating logger failed with:", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.WithFields(zap.String("test", "test"), zap.Int("num", i))
+	}
 }
 
+func BenchmarkZapWith(b *testing.B) {
+	logger, err := log.New("http://test@localhost/test", true)
+	if err != nil {
+		b.Fatal("creating logger failed with:", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Logger.With(zap.String("test", "test"), zap.Int("num", i))
+	}
+}
+
+func BenchmarkCtxWithFields(b *testing.B) {
+	logger, err := log.New("http://test@localhost/test", true)
+	if err != nil {
+		b.Fatal("creating logger failed with:", err)
+	}
+	ctx := logger.To(context.Background())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		log.WithFields(ctx, zap.String("test", "test"), zap.Int("num", i))
+	}
+}
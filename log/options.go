@@ -0,0 +1,275 @@
+package log
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Option configures a Logger built by NewWithOptions
+type Option func(*options)
+
+type options struct {
+	dsn         string
+	local       bool
+	level       zap.AtomicLevel
+	sinkLevels  map[Sink]zap.AtomicLevel
+	levelSpec   LevelSpec
+	environment string
+	release     string
+	serverName  string
+	dist        string
+	out         zapcore.WriteSyncer
+	errorOutput zapcore.WriteSyncer
+	file        *FileConfig
+	zapOptions  []zap.Option
+
+	breadcrumbLimit int
+	breadcrumbLevel zapcore.Level
+
+	sentrySampleRate float64
+	sentryRateLimit  int
+	sentryRateWindow time.Duration
+	beforeSend       BeforeSend
+	spool            *SpoolConfig
+	protocol         SentryProtocol
+	reporter         ErrorReporter
+
+	errorReportingService string
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		level:      zap.NewAtomicLevelAt(zap.InfoLevel),
+		sinkLevels: make(map[Sink]zap.AtomicLevel),
+
+		breadcrumbLimit: 50,
+		breadcrumbLevel: zapcore.DebugLevel,
+
+		sentrySampleRate: 1,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// OptSentryDSN enables error reporting to the sentry project identified by dsn
+// If dsn is empty, sentry reporting stays disabled
+func OptSentryDSN(dsn string) Option {
+	return func(o *options) {
+		o.dsn = dsn
+	}
+}
+
+// OptLocal toggles the human readable console output
+// If local is false, logs will be printed as stackdriver conformant json
+func OptLocal(local bool) Option {
+	return func(o *options) {
+		o.local = local
+	}
+}
+
+// OptAtomicLevel sets the level used for the console or stackdriver output
+// The level can be changed at runtime, defaults to Info
+func OptAtomicLevel(level zap.AtomicLevel) Option {
+	return func(o *options) {
+		o.level = level
+	}
+}
+
+// OptLevelSpec sets levels per logger name, relative to the output level the logger is built with
+// See LevelSpec for details
+func OptLevelSpec(spec LevelSpec) Option {
+	return func(o *options) {
+		o.levelSpec = spec
+	}
+}
+
+// OptSentryLevel sets the minimum level of entries reported to sentry, defaults to Error
+func OptSentryLevel(level zapcore.Level) Option {
+	return OptSinkLevel(SinkSentry, zap.NewAtomicLevelAt(level))
+}
+
+// OptSinkLevel sets the level of a single sink, independent from all other sinks
+// For the console and stackdriver sinks this equals OptAtomicLevel
+func OptSinkLevel(sink Sink, level zap.AtomicLevel) Option {
+	return func(o *options) {
+		if sink == SinkConsole || sink == SinkStackdriver {
+			o.level = level
+			return
+		}
+		o.sinkLevels[sink] = level
+	}
+}
+
+// OptSentryEnvironment sets the environment reported to sentry
+func OptSentryEnvironment(environment string) Option {
+	return func(o *options) {
+		o.environment = environment
+	}
+}
+
+// OptRelease sets the release reported to sentry
+func OptRelease(release string) Option {
+	return func(o *options) {
+		o.release = release
+	}
+}
+
+// OptSentryServerName sets the server name reported to sentry, defaults to the hostname
+func OptSentryServerName(serverName string) Option {
+	return func(o *options) {
+		o.serverName = serverName
+	}
+}
+
+// OptSentryDist sets the distribution of the release reported to sentry
+func OptSentryDist(dist string) Option {
+	return func(o *options) {
+		o.dist = dist
+	}
+}
+
+// OptOutput sets the writer all console or stackdriver logs are written to
+// Defaults to os.Stdout in local mode and os.Stderr in stackdriver mode
+func OptOutput(w io.Writer) Option {
+	return func(o *options) {
+		o.out = zapcore.Lock(zapcore.AddSync(w))
+	}
+}
+
+// OptErrorOutput sets the writer internal failures are reported to, like failing to rotate the log file
+// It is also used as zap.ErrorOutput, defaults to os.Stderr
+func OptErrorOutput(w io.Writer) Option {
+	return func(o *options) {
+		o.errorOutput = zapcore.Lock(zapcore.AddSync(w))
+	}
+}
+
+// OptFile additionally writes all logs to a rotating file as configured by config
+func OptFile(config FileConfig) Option {
+	return func(o *options) {
+		o.file = &config
+	}
+}
+
+// OptBreadcrumbLimit sets the number of entries kept as breadcrumbs per context, defaults to 50
+// NewWithOptions returns an error for negative limits
+func OptBreadcrumbLimit(limit int) Option {
+	return func(o *options) {
+		o.breadcrumbLimit = limit
+	}
+}
+
+// OptBreadcrumbLevel sets the minimum level of entries recorded as breadcrumbs, defaults to Debug
+func OptBreadcrumbLevel(level zapcore.Level) Option {
+	return func(o *options) {
+		o.breadcrumbLevel = level
+	}
+}
+
+// OptSentrySampleRate sets the share of events reported to sentry, between 0 and 1
+// All other sinks still receive every entry, NewWithOptions returns an error for rates outside of this range
+func OptSentrySampleRate(rate float64) Option {
+	return func(o *options) {
+		o.sentrySampleRate = rate
+	}
+}
+
+// OptSentryRateLimit limits the events reported to sentry to limit per window and similar entries
+// Entries are similar if they share their message and caller. When the window closes, an event reporting the number of
+// suppressed entries is sent. All other sinks still receive every entry
+func OptSentryRateLimit(limit int, window time.Duration) Option {
+	return func(o *options) {
+		o.sentryRateLimit = limit
+		o.sentryRateWindow = window
+	}
+}
+
+// OptBeforeSend sets a hook called with every event before it is sent to sentry
+func OptBeforeSend(fn BeforeSend) Option {
+	return func(o *options) {
+		o.beforeSend = fn
+	}
+}
+
+// OptSentrySpool stores sentry events failing to be sent in a directory and retries them until they succeed
+// Events left over from previous runs are sent on start
+func OptSentrySpool(config SpoolConfig) Option {
+	return func(o *options) {
+		o.spool = &config
+	}
+}
+
+// OptSentryProtocol selects the protocol used to report to the sentry DSN, defaults to SentryProtocolStore
+func OptSentryProtocol(protocol SentryProtocol) Option {
+	return func(o *options) {
+		o.protocol = protocol
+	}
+}
+
+// OptErrorReporter sets the ErrorReporter of the sentry sink, replacing the reporter built for the sentry DSN
+func OptErrorReporter(reporter ErrorReporter) Option {
+	return func(o *options) {
+		o.reporter = reporter
+	}
+}
+
+// OptErrorReporting marks stackdriver entries at Error and above as errors of service for stackdriver error reporting
+// The release of the logger is reported as service version. Entries without an error stack get the stack of the log site
+func OptErrorReporting(service string) Option {
+	return func(o *options) {
+		o.errorReportingService = service
+	}
+}
+
+// OptZapOptions adds zap.Options applied to the underlying zap.Logger after the defaults
+func OptZapOptions(opts ...zap.Option) Option {
+	return func(o *options) {
+		o.zapOptions = append(o.zapOptions, opts...)
+	}
+}
+
+// validate returns an error for option values the logger cannot be built with
+func (o *options) validate() error {
+	if !validSampleRate(o.sentrySampleRate) {
+		return errors.Errorf("sentry sample rate %v is not between 0 and 1", o.sentrySampleRate)
+	}
+	if o.breadcrumbLimit < 0 {
+		return errors.Errorf("breadcrumb limit %d is negative", o.breadcrumbLimit)
+	}
+	return nil
+}
+
+func validSampleRate(rate float64) bool {
+	return rate >= 0 && rate <= 1
+}
+
+// output returns the configured writer or def if none is set
+func (o *options) output(def *os.File) zapcore.WriteSyncer {
+	if o.out != nil {
+		return o.out
+	}
+	return zapcore.Lock(def)
+}
+
+// errorSink returns the configured error output or os.Stderr if none is set
+func (o *options) errorSink() zapcore.WriteSyncer {
+	if o.errorOutput != nil {
+		return o.errorOutput
+	}
+	return zapcore.Lock(os.Stderr)
+}
+
+// sinkLevel returns the configured level of sink or a new one at the sink's default
+func (o *options) sinkLevel(sink Sink) zap.AtomicLevel {
+	if level, ok := o.sinkLevels[sink]; ok {
+		return level
+	}
+	return zap.NewAtomicLevelAt(defaultSinkLevels[sink])
+}
@@ -0,0 +1,82 @@
+package log_test
+
+import (
+	"testing"
+
+	"github.com/seibert-media/golibs/log"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func Test_NewWithOptionsDefaults(t *testing.T) {
+	logger, err := log.NewWithOptions()
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+	if logger.Sentry != nil {
+		t.Fatal("sentry is not nil")
+	}
+	if logger.Level.Level() != zap.InfoLevel {
+		t.Fatal("level should default to info, got:", logger.Level.Level())
+	}
+}
+
+func Test_NewWithOptionsLevel(t *testing.T) {
+	logger, err := log.NewWithOptions(
+		log.OptLocal(true),
+		log.OptAtomicLevel(zap.NewAtomicLevelAt(zap.DebugLevel)),
+	)
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+	if !logger.Core().Enabled(zap.DebugLevel) {
+		t.Fatal("logger should be enabled for debug")
+	}
+}
+
+func Test_NewWithOptionsSentryLevel(t *testing.T) {
+	logger, err := log.NewWithOptions(
+		log.OptLocal(true),
+		log.OptAtomicLevel(zap.NewAtomicLevelAt(zap.ErrorLevel)),
+		log.OptSentryDSN("http://test@localhost/test"),
+		log.OptSentryLevel(zap.WarnLevel),
+	)
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+	if logger.Sentry == nil {
+		t.Fatal("sentry is nil")
+	}
+	if !logger.Core().Enabled(zap.WarnLevel) {
+		t.Fatal("logger should be enabled for warn through sentry")
+	}
+	if logger.Core().Enabled(zap.InfoLevel) {
+		t.Fatal("logger should not be enabled for info")
+	}
+}
+
+func Test_NewWithOptionsZapOptions(t *testing.T) {
+	var count int
+	logger, err := log.NewWithOptions(
+		log.OptLocal(true),
+		log.OptZapOptions(zap.Hooks(func(zapcore.Entry) error {
+			count++
+			return nil
+		})),
+	)
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+	logger.Info("test")
+	logger.WithFields(zap.String("test", "test")).Info("test")
+	if count != 2 {
+		t.Fatal("hook should have been called twice, got:", count)
+	}
+}
+
+func Test_NewWithOptionsInvalidSentryURL(t *testing.T) {
+	_, err := log.NewWithOptions(log.OptSentryDSN("^"))
+	if err == nil {
+		t.Errorf("NewWithOptions() should have returned error")
+	}
+}
@@ -0,0 +1,121 @@
+package log
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getsentry/raven-go"
+	"go.uber.org/zap/zapcore"
+)
+
+// sentryLimiter samples the events reported to sentry and limits them per fingerprint and window
+// It is shared by all cores reporting to the same client
+type sentryLimiter struct {
+	sampleRate float64
+	limit      int
+	window     time.Duration
+
+	mu      sync.Mutex
+	rand    *rand.Rand
+	buckets map[string]*limitBucket
+}
+
+// limitBucket counts the events of a single fingerprint within the current window
+type limitBucket struct {
+	core       *sentryCore
+	entry      zapcore.Entry
+	count      int
+	suppressed int
+	timer      *time.Timer
+}
+
+func newSentryLimiter(sampleRate float64, limit int, window time.Duration) *sentryLimiter {
+	return &sentryLimiter{
+		sampleRate: sampleRate,
+		limit:      limit,
+		window:     window,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		buckets:    make(map[string]*limitBucket),
+	}
+}
+
+// sample returns false if the entry is not to be reported according to the sample rate
+func (l *sentryLimiter) sample() bool {
+	if l.sampleRate >= 1 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rand.Float64() < l.sampleRate
+}
+
+// allow returns false if the limit of events with the fingerprint of the entry is exceeded within the current window
+// The first core reporting a fingerprint within a window is used for reporting the summary of suppressed events
+func (l *sentryLimiter) allow(c *sentryCore, ent zapcore.Entry, fields []zapcore.Field) bool {
+	if l.limit <= 0 || l.window <= 0 {
+		return true
+	}
+
+	key := strings.Join(limitFingerprint(ent, c.fields, fields), "\x00")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &limitBucket{core: c, entry: ent}
+		bucket.timer = time.AfterFunc(l.window, func() { l.expire(key, bucket) })
+		l.buckets[key] = bucket
+	}
+	bucket.count++
+	if bucket.count > l.limit {
+		bucket.suppressed++
+		return false
+	}
+	return true
+}
+
+// expire closes the window of bucket and reports its suppressed events
+func (l *sentryLimiter) expire(key string, bucket *limitBucket) {
+	l.mu.Lock()
+	if l.buckets[key] != bucket {
+		l.mu.Unlock()
+		return
+	}
+	delete(l.buckets, key)
+	l.mu.Unlock()
+
+	bucket.report(l.window)
+}
+
+// flush closes all windows and reports their suppressed events
+func (l *sentryLimiter) flush() {
+	l.mu.Lock()
+	buckets := l.buckets
+	l.buckets = make(map[string]*limitBucket)
+	l.mu.Unlock()
+
+	for _, bucket := range buckets {
+		bucket.timer.Stop()
+		bucket.report(l.window)
+	}
+}
+
+// report sends a summary event if any events got suppressed
+func (b *limitBucket) report(window time.Duration) {
+	if b.suppressed == 0 {
+		return
+	}
+	packet := raven.NewPacket(fmt.Sprintf("suppressed %d similar errors", b.suppressed))
+	packet.Level = zapLevelToRavenSeverity[b.entry.Level]
+	packet.Logger = b.entry.LoggerName
+	packet.Culprit = b.entry.Caller.TrimmedPath()
+	packet.Extra["message"] = b.entry.Message
+	packet.Extra["suppressed"] = b.suppressed
+	packet.Extra["window"] = window.String()
+	b.core.meta.apply(packet)
+	b.core.state.capture(packet)
+}
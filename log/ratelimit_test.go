@@ -0,0 +1,108 @@
+package log_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getsentry/raven-go"
+	"github.com/seibert-media/golibs/log"
+	"github.com/seibert-media/golibs/logtest/sentrytest"
+)
+
+func Test_SentryRateLimit(t *testing.T) {
+	server := sentrytest.NewServer()
+	defer server.Close()
+	logger, buf := newTestLogger(t, log.OptSentryDSN(server.DSN()), log.OptSentryRateLimit(2, 50*time.Millisecond))
+
+	for i := 0; i < 10; i++ {
+		logger.Error("hot loop")
+	}
+	logger.Error("other")
+
+	if lines := strings.Count(buf.String(), "hot loop"); lines != 10 {
+		t.Fatal("console should receive every entry, got:", lines)
+	}
+
+	server.AssertEvent(t, "suppressed 8 similar errors", raven.ERROR)
+	events, _ := server.WaitForEvents(4, time.Second)
+	var hot int
+	for _, event := range events {
+		if event.Message == "hot loop" {
+			hot++
+		}
+	}
+	if hot != 2 || len(events) != 4 {
+		t.Fatal("only the limit should be reported, got:", hot, len(events))
+	}
+	if stats := logger.SentryStats(); stats.Suppressed != 8 {
+		t.Fatal("suppressed events miscounted:", stats)
+	}
+
+	// the next window reports again
+	logger.Error("hot loop")
+	logger.Sync()
+	if len(server.Events()) != 5 {
+		t.Fatal("new window should be reported, got:", len(server.Events()))
+	}
+}
+
+func Test_SentryRateLimitClose(t *testing.T) {
+	server := sentrytest.NewServer()
+	defer server.Close()
+	logger, _ := newTestLogger(t, log.OptSentryDSN(server.DSN()), log.OptSentryRateLimit(1, time.Hour))
+
+	for i := 0; i < 2; i++ {
+		logger.Error("hot loop")
+	}
+	if err := logger.Close(context.Background()); err != nil {
+		t.Fatal("closing failed with:", err)
+	}
+	event := server.AssertEvent(t, "suppressed 1 similar errors", raven.ERROR)
+	if event.Extra["message"] != "hot loop" {
+		t.Fatal("summary should contain the original message, got:", event.Extra)
+	}
+}
+
+func Test_SentrySampleRate(t *testing.T) {
+	server := sentrytest.NewServer()
+	defer server.Close()
+	logger, buf := newTestLogger(t, log.OptSentryDSN(server.DSN()), log.OptSentrySampleRate(0))
+
+	logger.Error("sampled")
+	logger.Sync()
+	if len(server.Events()) != 0 {
+		t.Fatal("no events should be reported")
+	}
+	if !strings.Contains(buf.String(), "sampled") {
+		t.Fatal("console should receive every entry")
+	}
+	if stats := logger.SentryStats(); stats.Sampled != 1 || stats.Captured != 0 {
+		t.Fatal("sampled events miscounted:", stats)
+	}
+}
+
+func Test_SentryRateLimitFingerprint(t *testing.T) {
+	server := sentrytest.NewServer()
+	defer server.Close()
+	logger, _ := newTestLogger(t, log.OptSentryDSN(server.DSN()), log.OptSentryRateLimit(1, time.Hour))
+
+	logger.Error("connection lost", log.Fingerprint("db"))
+	logger.Error("query timed out", log.Fingerprint("db"))
+	logger.Sync()
+	if events := server.Events(); len(events) != 1 || events[0].Message != "connection lost" {
+		t.Fatal("entries with the same fingerprint should share a limit, got:", len(events))
+	}
+	if stats := logger.SentryStats(); stats.Suppressed != 1 {
+		t.Fatal("suppressed events miscounted:", stats)
+	}
+}
+
+func Test_SentrySampleRateInvalid(t *testing.T) {
+	for _, rate := range []float64{-0.1, 1.5} {
+		if _, err := log.NewWithOptions(log.OptSentrySampleRate(rate)); err == nil {
+			t.Fatal("NewWithOptions() should have returned error for rate", rate)
+		}
+	}
+}
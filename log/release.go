@@ -0,0 +1,137 @@
+package log
+
+import (
+	"github.com/getsentry/raven-go"
+	"go.uber.org/atomic"
+	"go.uber.org/zap/zapcore"
+)
+
+// sentryDistTag is the tag the distribution is reported as, raven packets have no dedicated field for it
+const sentryDistTag = "dist"
+
+// sentryMeta describes the deployment reported with every sentry event
+// It is part of the logger itself, so every derived logger keeps it regardless of the order of derivation
+type sentryMeta struct {
+	release     string
+	environment string
+	serverName  string
+	dist        string
+
+	// sharedRelease is set by Logger.WithRelease for all loggers built by the same call and used unless release is set
+	sharedRelease *atomic.String
+}
+
+// currentRelease returns the release overridden for this logger or the shared one
+func (m sentryMeta) currentRelease() string {
+	if len(m.release) > 0 || m.sharedRelease == nil {
+		return m.release
+	}
+	return m.sharedRelease.Load()
+}
+
+// apply sets the non empty values on packet, the client defaults are used for all others
+func (m sentryMeta) apply(packet *raven.Packet) {
+	if release := m.currentRelease(); len(release) > 0 {
+		packet.Release = release
+	}
+	if len(m.environment) > 0 {
+		packet.Environment = m.environment
+	}
+	if len(m.serverName) > 0 {
+		packet.ServerName = m.serverName
+	}
+}
+
+// WithRelease sets the release reported to sentry by the logger and all other loggers sharing its sentry client
+// The logger itself is returned, use WithReleaseOverride to only change the release of a derived logger
+func (l *Logger) WithRelease(release string) *Logger {
+	if l.nop || l.meta.sharedRelease == nil {
+		return l
+	}
+	l.meta.sharedRelease.Store(release)
+	if l.Reporter != nil {
+		l.Reporter.SetRelease(release)
+	}
+	return l
+}
+
+// WithReleaseOverride returns a new logger reporting release to sentry
+// Neither the parent logger nor the shared sentry client are modified, so the call can happen at any point of the logger derivation
+func (l *Logger) WithReleaseOverride(release string) *Logger {
+	meta := l.meta
+	meta.release = release
+	return l.withMeta(meta)
+}
+
+// WithEnvironment returns a new logger reporting environment to sentry
+func (l *Logger) WithEnvironment(environment string) *Logger {
+	meta := l.meta
+	meta.environment = environment
+	return l.withMeta(meta)
+}
+
+// WithServerName returns a new logger reporting serverName to sentry
+func (l *Logger) WithServerName(serverName string) *Logger {
+	meta := l.meta
+	meta.serverName = serverName
+	return l.withMeta(meta)
+}
+
+// WithDist returns a new logger reporting dist as distribution of the release to sentry
+func (l *Logger) WithDist(dist string) *Logger {
+	meta := l.meta
+	meta.dist = dist
+	return l.withMeta(meta)
+}
+
+// Release reported to sentry
+func (l *Logger) Release() string {
+	return l.meta.currentRelease()
+}
+
+// Environment reported to sentry
+func (l *Logger) Environment() string {
+	return l.meta.environment
+}
+
+// ServerName reported to sentry, empty if the hostname is used
+func (l *Logger) ServerName() string {
+	return l.meta.serverName
+}
+
+// Dist reported to sentry
+func (l *Logger) Dist() string {
+	return l.meta.dist
+}
+
+// metaKey is the key of the field passing the sentryMeta of a derived logger to its cores
+const metaKey = "_sentry_meta"
+
+func metaField(meta sentryMeta) zapcore.Field {
+	return zapcore.Field{Key: metaKey, Type: zapcore.SkipType, Interface: meta}
+}
+
+// metaOf returns the sentryMeta of the last meta field
+func metaOf(fields []zapcore.Field) (sentryMeta, bool) {
+	var (
+		meta  sentryMeta
+		found bool
+	)
+	for _, field := range fields {
+		if m, ok := field.Interface.(sentryMeta); ok && field.Key == metaKey {
+			meta, found = m, true
+		}
+	}
+	return meta, found
+}
+
+// withMeta returns a new logger whose sentry and stackdriver cores report meta
+func (l *Logger) withMeta(meta sentryMeta) *Logger {
+	if l.nop {
+		return l
+	}
+	log := l.clone()
+	log.Logger = l.Logger.With(metaField(meta))
+	log.meta = meta
+	return log
+}
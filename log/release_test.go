@@ -0,0 +1,104 @@
+package log_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/seibert-media/golibs/log"
+	"go.uber.org/zap"
+)
+
+func Test_ReleaseDerivation(t *testing.T) {
+	derivations := map[string]func(*log.Logger) *log.Logger{
+		"WithFields":      func(l *log.Logger) *log.Logger { return l.WithFields(zap.String("key", "value")) },
+		"Named":           func(l *log.Logger) *log.Logger { return l.Named("db") },
+		"WithLevel":       func(l *log.Logger) *log.Logger { return l.WithLevel(zap.DebugLevel) },
+		"WithBreadcrumbs": func(l *log.Logger) *log.Logger { return l.WithBreadcrumbs() },
+		"WithSentryUser":  func(l *log.Logger) *log.Logger { return l.WithSentryUser("1", "", "") },
+		"Context": func(l *log.Logger) *log.Logger {
+			ctx := log.WithFields(l.To(context.Background()), zap.String("key", "value"))
+			return log.From(log.WithLevel(ctx, zap.DebugLevel))
+		},
+	}
+
+	for name, derive := range derivations {
+		t.Run(name, func(t *testing.T) {
+			for _, releaseFirst := range []bool{true, false} {
+				reporter := &recordingReporter{}
+				logger, _ := newTestLogger(t, log.OptErrorReporter(reporter), log.OptRelease("v1"), log.OptSentryEnvironment("dev"))
+				if releaseFirst {
+					logger = derive(logger.WithReleaseOverride("v2").WithEnvironment("prod").WithServerName("host").WithDist("amd64"))
+				} else {
+					logger = derive(logger).WithReleaseOverride("v2").WithEnvironment("prod").WithServerName("host").WithDist("amd64")
+				}
+				logger.Error("test")
+				logger.Sync()
+
+				if logger.Release() != "v2" || logger.Environment() != "prod" || logger.ServerName() != "host" || logger.Dist() != "amd64" {
+					t.Fatal("logger lost its configuration:", logger.Release(), logger.Environment(), logger.ServerName(), logger.Dist())
+				}
+				packet := reporter.Packets()[0]
+				if packet.Release != "v2" || packet.Environment != "prod" || packet.ServerName != "host" {
+					t.Fatal("packet reported wrong configuration:", packet.Release, packet.Environment, packet.ServerName)
+				}
+				if tagsOf(packet)["dist"] != "amd64" {
+					t.Fatal("dist should be reported as tag, got:", packet.Tags)
+				}
+				if reporter.Release() != "v1" {
+					t.Fatal("shared reporter should not be modified, got:", reporter.Release())
+				}
+			}
+		})
+	}
+}
+
+func Test_ReleaseShared(t *testing.T) {
+	reporter := &recordingReporter{}
+	logger, _ := newTestLogger(t, log.OptErrorReporter(reporter), log.OptRelease("v1"))
+	derived := logger.WithFields(zap.String("key", "value"))
+	overridden := logger.WithReleaseOverride("v3")
+	if derived.WithRelease("v2") != derived {
+		t.Fatal("WithRelease should return the logger itself")
+	}
+	logger.Error("test")
+	overridden.Error("test")
+	logger.Sync()
+
+	if logger.Release() != "v2" || reporter.Release() != "v2" {
+		t.Fatal("release should be set for all loggers sharing the client, got:", logger.Release(), reporter.Release())
+	}
+	packets := reporter.Packets()
+	if packets[0].Release != "v2" || packets[1].Release != "v3" {
+		t.Fatal("packet reported wrong release:", packets[0].Release, packets[1].Release)
+	}
+}
+
+func Test_ReleaseFromOptions(t *testing.T) {
+	reporter := &recordingReporter{}
+	logger, _ := newTestLogger(t, log.OptErrorReporter(reporter),
+		log.OptRelease("v1"),
+		log.OptSentryEnvironment("dev"),
+		log.OptSentryServerName("host"),
+		log.OptSentryDist("amd64"),
+	)
+	logger.WithFields(zap.String("key", "value")).Error("test")
+	logger.Sync()
+
+	packet := reporter.Packets()[0]
+	if packet.Release != "v1" || packet.Environment != "dev" || packet.ServerName != "host" || tagsOf(packet)["dist"] != "amd64" {
+		t.Fatal("packet reported wrong configuration:", packet.Release, packet.Environment, packet.ServerName, packet.Tags)
+	}
+}
+
+func Test_ReleaseWithoutSentry(t *testing.T) {
+	logger, err := log.NewWithOptions(log.OptLocal(true), log.OptRelease("v1"))
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+	if logger.WithFields(zap.String("key", "value")).WithReleaseOverride("v2").Release() != "v2" {
+		t.Fatal("release should be kept without sentry")
+	}
+	if logger.Release() != "v1" {
+		t.Fatal("parent logger should not be modified, got:", logger.Release())
+	}
+}
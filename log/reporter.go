@@ -0,0 +1,289 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/getsentry/raven-go"
+	"github.com/pkg/errors"
+)
+
+// ErrorReporter delivers the events of the sentry sink to an error tracking backend
+// Events are described as raven.Packet, which is serialized to the event payload shared by all sentry protocols
+type ErrorReporter interface {
+	// Capture queues packet without blocking and calls done with the result of sending it exactly once
+	Capture(packet *raven.Packet, done func(error))
+	// Flush blocks until all queued events are sent or ctx is done
+	Flush(ctx context.Context) error
+	// Close stops sending, Capture must not be called afterwards
+	Close() error
+	// SetRelease sets the release of events not setting their own
+	SetRelease(release string)
+	// SetEnvironment sets the environment of events not setting their own
+	SetEnvironment(environment string)
+}
+
+// ErrEventDropped is passed to the done func of Capture if the queue of the ErrorReporter is full
+var ErrEventDropped = errors.New("sentry event dropped")
+
+// SentryProtocol selects the built-in ErrorReporter used for the sentry DSN
+type SentryProtocol string
+
+// Available sentry protocols
+const (
+	// SentryProtocolStore uses raven-go and the legacy store endpoint
+	SentryProtocolStore SentryProtocol = "store"
+	// SentryProtocolEnvelope uses the envelope endpoint of current sentry versions
+	SentryProtocolEnvelope SentryProtocol = "envelope"
+)
+
+// String implements flag.Value
+func (p *SentryProtocol) String() string {
+	return string(*p)
+}
+
+// Set implements flag.Value
+func (p *SentryProtocol) Set(value string) error {
+	switch protocol := SentryProtocol(strings.ToLower(value)); protocol {
+	case SentryProtocolStore, SentryProtocolEnvelope:
+		*p = protocol
+		return nil
+	default:
+		return errors.Errorf("unknown sentry protocol %q", value)
+	}
+}
+
+// ravenReporter is the ErrorReporter adapter for raven.Client
+// The results of sending are tracked by wrapping the transport and drop handler of the client
+type ravenReporter struct {
+	client *raven.Client
+
+	// pending maps the captured packets to their done funcs
+	pending sync.Map
+}
+
+// NewRavenReporter returns an ErrorReporter sending events using client
+// The Transport and DropHandler of client are wrapped to report the results of sending
+func NewRavenReporter(client *raven.Client) ErrorReporter {
+	r := &ravenReporter{client: client}
+	client.Transport = &reporterTransport{Transport: client.Transport, reporter: r}
+	drop := client.DropHandler
+	client.DropHandler = func(packet *raven.Packet) {
+		if drop != nil {
+			drop(packet)
+		}
+		r.done(packet, ErrEventDropped)
+	}
+	return r
+}
+
+// Capture implements ErrorReporter
+func (r *ravenReporter) Capture(packet *raven.Packet, done func(error)) {
+	r.pending.Store(packet, done)
+	if id, ch := r.client.Capture(packet, nil); len(id) == 0 {
+		// the packet is not queued if sampled, ignored or invalid, so neither the transport nor the drop handler is called
+		r.pending.Delete(packet)
+		select {
+		case err := <-ch:
+			done(err)
+		default:
+			done(nil)
+		}
+	}
+}
+
+// Flush implements ErrorReporter
+func (r *ravenReporter) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	go func() {
+		r.client.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close implements ErrorReporter
+func (r *ravenReporter) Close() error {
+	r.client.Close()
+	return nil
+}
+
+// SetRelease implements ErrorReporter
+func (r *ravenReporter) SetRelease(release string) {
+	r.client.SetRelease(release)
+}
+
+// SetEnvironment implements ErrorReporter
+func (r *ravenReporter) SetEnvironment(environment string) {
+	r.client.SetEnvironment(environment)
+}
+
+func (r *ravenReporter) done(packet *raven.Packet, err error) {
+	if done, ok := r.pending.Load(packet); ok {
+		r.pending.Delete(packet)
+		done.(func(error))(err)
+	}
+}
+
+// reporterTransport passes the results of sending through Transport to the reporter
+type reporterTransport struct {
+	raven.Transport
+	reporter *ravenReporter
+}
+
+// Send implements raven.Transport
+func (t *reporterTransport) Send(url, authHeader string, packet *raven.Packet) error {
+	err := t.Transport.Send(url, authHeader, packet)
+	t.reporter.done(packet, err)
+	return err
+}
+
+// newReporter builds the ErrorReporter configured by o, the raven client is only returned for the store protocol
+func newReporter(o *options) (ErrorReporter, *raven.Client, *sentrySpool, error) {
+	if o.reporter != nil {
+		if o.spool != nil {
+			return nil, nil, nil, errors.New("sentry spool is not supported for custom error reporters")
+		}
+		return o.reporter, nil, nil, nil
+	}
+	if len(o.dsn) == 0 {
+		return nil, nil, nil, nil
+	}
+
+	dsn, err := parseSentryDSN(o.dsn)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if o.protocol == SentryProtocolEnvelope {
+		envelope, err := newEnvelopeReporter(o.dsn)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if o.spool != nil {
+			envelope.spool, err = newSentrySpool(*o.spool, envelope.post, o.errorSink())
+			if err != nil {
+				envelope.Close()
+				return nil, nil, nil, err
+			}
+		}
+		return envelope, nil, envelope.spool, nil
+	}
+
+	client, err := raven.New(o.dsn)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var spool *sentrySpool
+	if o.spool != nil {
+		httpClient := http.DefaultClient
+		if t, ok := client.Transport.(*raven.HTTPTransport); ok && t.Client != nil {
+			httpClient = t.Client
+		}
+		storeURL, auth := dsn.url("store"), dsn.auth(4)
+		spool, err = newSentrySpool(*o.spool, func(data []byte) error {
+			return postEvent(httpClient, storeURL, auth, "application/json", data)
+		}, o.errorSink())
+		if err != nil {
+			client.Close()
+			return nil, nil, nil, err
+		}
+		client.Transport = &spoolTransport{Transport: client.Transport, spool: spool}
+	}
+	return NewRavenReporter(client), client, spool, nil
+}
+
+// postEvent sends body to url, returning a statusError for responses other than 200 OK
+func postEvent(client *http.Client, url, auth, contentType string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Sentry-Auth", auth)
+	req.Header.Set("Content-Type", contentType)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return &statusError{code: res.StatusCode}
+	}
+	return nil
+}
+
+// statusError is returned for responses other than 200 OK
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("got http status %d", e.code)
+}
+
+// sentryDSN holds the parts of a sentry DSN
+type sentryDSN struct {
+	base    url.URL
+	prefix  string
+	project string
+	key     string
+	secret  string
+}
+
+// parseSentryDSN splits dsn like raven.Client does
+func parseSentryDSN(dsn string) (*sentryDSN, error) {
+	uri, err := url.Parse(dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing sentry dsn")
+	}
+	if uri.User == nil {
+		return nil, errors.New("sentry dsn is missing the public key")
+	}
+
+	d := &sentryDSN{key: uri.User.Username()}
+	d.secret, _ = uri.User.Password()
+
+	path := strings.TrimSuffix(uri.Path, "/")
+	i := strings.LastIndex(path, "/")
+	if i < 0 || i == len(path)-1 {
+		return nil, errors.New("sentry dsn is missing the project id")
+	}
+	d.prefix, d.project = path[:i], path[i+1:]
+
+	uri.User = nil
+	uri.Path = ""
+	uri.RawQuery = ""
+	d.base = *uri
+	return d, nil
+}
+
+// url of the endpoint, e.g. "store" or "envelope"
+func (d *sentryDSN) url(endpoint string) string {
+	uri := d.base
+	uri.Path = d.prefix + "/api/" + d.project + "/" + endpoint + "/"
+	return uri.String()
+}
+
+// auth returns the X-Sentry-Auth header for the protocol version
+func (d *sentryDSN) auth(version int) string {
+	auth := "Sentry sentry_version=" + strconv.Itoa(version) + ", sentry_client=golibs-log/1.0, sentry_key=" + d.key
+	if len(d.secret) > 0 {
+		auth += ", sentry_secret=" + d.secret
+	}
+	return auth
+}
@@ -0,0 +1,144 @@
+package log_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/getsentry/raven-go"
+	"github.com/seibert-media/golibs/log"
+	"github.com/seibert-media/golibs/logtest/sentrytest"
+	"go.uber.org/zap"
+)
+
+func Test_ReporterProtocols(t *testing.T) {
+	for _, protocol := range []log.SentryProtocol{log.SentryProtocolStore, log.SentryProtocolEnvelope} {
+		t.Run(string(protocol), func(t *testing.T) {
+			server := sentrytest.NewServer()
+			defer server.Close()
+
+			logger, err := log.NewWithOptions(
+				log.OptLocal(true),
+				log.OptOutput(ioutil.Discard),
+				log.OptSentryDSN(server.DSN()),
+				log.OptSentryProtocol(protocol),
+				log.OptRelease("v1"),
+				log.OptSentryEnvironment("dev"),
+			)
+			if err != nil {
+				t.Fatal("creating logger failed with:", err)
+			}
+			if logger.Reporter == nil {
+				t.Fatal("reporter should be set")
+			}
+			if (logger.Sentry != nil) != (protocol == log.SentryProtocolStore) {
+				t.Fatal("raven client should only be set for the store protocol")
+			}
+
+			ctx := log.WithBreadcrumbs(logger.To(context.Background()))
+			log.From(ctx).Info("before")
+			log.From(ctx).Error("failed", zap.String("#tag", "value"))
+			if err := logger.Close(context.Background()); err != nil {
+				t.Fatal("closing failed with:", err)
+			}
+
+			event := server.AssertEvent(t, "failed", raven.ERROR)
+			if event.Release != "v1" || event.Environment != "dev" || len(event.EventID) == 0 {
+				t.Fatal("event defaults not set, got:", event.Release, event.Environment, event.EventID)
+			}
+			if tag, _ := event.Tag("tag"); tag != "value" {
+				t.Fatal("tag not reported, got:", event.Tags)
+			}
+			if len(event.Raw["breadcrumbs"]) == 0 {
+				t.Fatal("breadcrumbs not reported")
+			}
+			if stats := logger.SentryStats(); stats.Sent != 1 || stats.Pending() != 0 {
+				t.Fatal("results should be counted, got:", stats)
+			}
+		})
+	}
+}
+
+func Test_ReporterEnvelopeSpool(t *testing.T) {
+	server := sentrytest.NewServer()
+	defer server.Close()
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	server.Fail(http.StatusTooManyRequests)
+	logger, err := log.NewWithOptions(
+		log.OptLocal(true),
+		log.OptOutput(ioutil.Discard),
+		log.OptSentryDSN(server.DSN()),
+		log.OptSentryProtocol(log.SentryProtocolEnvelope),
+		log.OptSentrySpool(log.SpoolConfig{Dir: dir, MinBackoff: 10 * time.Millisecond}),
+	)
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+	defer logger.Close(context.Background())
+
+	logger.Error("offline")
+	logger.Sync()
+	if stats := logger.SentryStats(); stats.Spooled != 1 {
+		t.Fatal("event should be spooled, got:", stats)
+	}
+
+	server.Fail(0)
+	server.AssertEvent(t, "offline", raven.ERROR)
+}
+
+func Test_ReporterOptions(t *testing.T) {
+	if _, err := log.NewWithOptions(
+		log.OptErrorReporter(&recordingReporter{}),
+		log.OptSentrySpool(log.SpoolConfig{Dir: "spool"}),
+	); err == nil {
+		t.Fatal("spool should not be supported for custom reporters")
+	}
+
+	var protocol log.SentryProtocol
+	if err := protocol.Set("ENVELOPE"); err != nil || protocol != log.SentryProtocolEnvelope {
+		t.Fatal("protocol should be parsed, got:", protocol, err)
+	}
+	if err := protocol.Set("http"); err == nil {
+		t.Fatal("unknown protocol should fail")
+	}
+}
+
+func Test_RavenReporterNotQueued(t *testing.T) {
+	server := sentrytest.NewServer()
+	defer server.Close()
+
+	logger, err := log.NewWithOptions(
+		log.OptLocal(true),
+		log.OptOutput(ioutil.Discard),
+		log.OptSentryDSN(server.DSN()),
+	)
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+	logger.Sentry.SetIgnoreErrors([]string{"ignored"})
+	logger.Error("ignored")
+	logger.Sentry.SetSampleRate(0)
+
+	panicked := make(chan struct{})
+	go func() {
+		defer close(panicked)
+		defer func() { recover() }()
+		logger.Panic("sampled")
+	}()
+	select {
+	case <-panicked:
+	case <-time.After(time.Second):
+		t.Fatal("panic should not wait for events dropped by the raven client")
+	}
+
+	if stats := logger.SentryStats(); stats.Captured != 2 || stats.Pending() != 0 {
+		t.Fatal("events dropped by the raven client should not be pending, got:", stats)
+	}
+	if err := logger.Close(context.Background()); err != nil {
+		t.Fatal("closing failed with:", err)
+	}
+}
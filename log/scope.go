@@ -0,0 +1,82 @@
+package log
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/getsentry/raven-go"
+)
+
+// sentryScope holds the user, request and tags attached to events reported through a context
+// Scopes are never modified, deriving a context copies the scope of its parent
+type sentryScope struct {
+	user    *raven.User
+	request *http.Request
+	tags    map[string]string
+}
+
+func (s *sentryScope) clone() *sentryScope {
+	if s == nil {
+		return &sentryScope{}
+	}
+	clone := *s
+	return &clone
+}
+
+// WithSentryUser returns a context whose logger reports the user with every sentry event
+func WithSentryUser(ctx context.Context, id, email, ip string) context.Context {
+	return WithLogger(ctx, From(ctx).WithSentryUser(id, email, ip))
+}
+
+// WithSentryRequest returns a context whose logger reports r with every sentry event
+func WithSentryRequest(ctx context.Context, r *http.Request) context.Context {
+	return WithLogger(ctx, From(ctx).WithSentryRequest(r))
+}
+
+// WithSentryTags returns a context whose logger reports tags with every sentry event
+func WithSentryTags(ctx context.Context, tags map[string]string) context.Context {
+	return WithLogger(ctx, From(ctx).WithSentryTags(tags))
+}
+
+// WithSentryUser returns a new logger reporting the user with every sentry event
+// Unlike Sentry.SetUserContext the shared client is not modified
+func (l *Logger) WithSentryUser(id, email, ip string) *Logger {
+	return l.withSentry(func(c *sentryCore) *sentryCore {
+		return c.withScope(func(s *sentryScope) *sentryScope {
+			s = s.clone()
+			s.user = &raven.User{ID: id, Email: email, IP: ip}
+			return s
+		})
+	})
+}
+
+// WithSentryRequest returns a new logger reporting r with every sentry event
+// A request passed as zapsentry.HTTPRequest field takes precedence
+func (l *Logger) WithSentryRequest(r *http.Request) *Logger {
+	return l.withSentry(func(c *sentryCore) *sentryCore {
+		return c.withScope(func(s *sentryScope) *sentryScope {
+			s = s.clone()
+			s.request = r
+			return s
+		})
+	})
+}
+
+// WithSentryTags returns a new logger reporting tags with every sentry event
+// Tags are merged with the ones already set, tags passed as "#" prefixed fields take precedence
+func (l *Logger) WithSentryTags(tags map[string]string) *Logger {
+	return l.withSentry(func(c *sentryCore) *sentryCore {
+		return c.withScope(func(s *sentryScope) *sentryScope {
+			s = s.clone()
+			merged := make(map[string]string, len(s.tags)+len(tags))
+			for key, value := range s.tags {
+				merged[key] = value
+			}
+			for key, value := range tags {
+				merged[key] = value
+			}
+			s.tags = merged
+			return s
+		})
+	})
+}
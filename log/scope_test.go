@@ -0,0 +1,85 @@
+package log_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/getsentry/raven-go"
+	"github.com/seibert-media/golibs/log"
+	"go.uber.org/zap"
+)
+
+func interfaceOf(packet *raven.Packet, class string) raven.Interface {
+	for _, i := range packet.Interfaces {
+		if i.Class() == class {
+			return i
+		}
+	}
+	return nil
+}
+
+func tagsOf(packet *raven.Packet) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range packet.Tags {
+		tags[tag.Key] = tag.Value
+	}
+	return tags
+}
+
+func Test_SentryScope(t *testing.T) {
+	reporter := &recordingReporter{}
+	logger, _ := newTestLogger(t, log.OptErrorReporter(reporter))
+	ctx := logger.To(context.Background())
+
+	ctx = log.WithSentryUser(ctx, "1", "user@example.com", "127.0.0.1")
+	ctx = log.WithSentryTags(ctx, map[string]string{"team": "a", "tenant": "x"})
+	ctx = log.WithSentryTags(ctx, map[string]string{"tenant": "y"})
+	ctx = log.WithSentryRequest(ctx, httptest.NewRequest("GET", "/path", nil))
+	log.From(ctx).Error("scoped", zap.String("#team", "b"))
+	logger.Error("unscoped")
+	logger.Sync()
+
+	packets := reporter.Packets()
+	if len(packets) != 2 {
+		t.Fatal("two packets should be sent, got:", len(packets))
+	}
+	user, ok := interfaceOf(packets[0], "user").(*raven.User)
+	if !ok || user.ID != "1" || user.Email != "user@example.com" || user.IP != "127.0.0.1" {
+		t.Fatal("user should be reported, got:", user)
+	}
+	if tags := tagsOf(packets[0]); tags["team"] != "b" || tags["tenant"] != "y" {
+		t.Fatal("tags should be merged, got:", tags)
+	}
+	if req, ok := interfaceOf(packets[0], "request").(*raven.Http); !ok || req.URL != "http://example.com/path" {
+		t.Fatal("request should be reported, got:", req)
+	}
+
+	if interfaceOf(packets[1], "user") != nil || interfaceOf(packets[1], "request") != nil || len(packets[1].Tags) != 0 {
+		t.Fatal("scope should not leak into the parent logger, got:", packets[1].Interfaces, packets[1].Tags)
+	}
+}
+
+func Test_SentryScopeConcurrent(t *testing.T) {
+	reporter := &recordingReporter{}
+	logger, _ := newTestLogger(t, log.OptErrorReporter(reporter))
+
+	var wg sync.WaitGroup
+	for _, id := range []string{"1", "2", "3", "4"} {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			ctx := log.WithSentryUser(logger.To(context.Background()), id, "", "")
+			log.From(ctx).Error(id)
+		}(id)
+	}
+	wg.Wait()
+	logger.Sync()
+
+	for _, packet := range reporter.Packets() {
+		if user := interfaceOf(packet, "user").(*raven.User); user.ID != packet.Message {
+			t.Fatal("user of another context reported:", user.ID, packet.Message)
+		}
+	}
+}
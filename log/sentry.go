@@ -0,0 +1,304 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/getsentry/raven-go"
+	"github.com/tchap/zapext/types"
+	"github.com/tchap/zapext/zapsentry"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// BeforeSend is called with every event before it is sent to sentry
+// The returned packet is sent instead, allowing to scrub or enrich it. Returning nil drops the event
+type BeforeSend func(*raven.Packet) *raven.Packet
+
+// sentryStackTraceContext is the number of source lines sent around each stack frame
+const sentryStackTraceContext = 5
+
+var zapLevelToRavenSeverity = map[zapcore.Level]raven.Severity{
+	zapcore.DebugLevel:  raven.DEBUG,
+	zapcore.InfoLevel:   raven.INFO,
+	zapcore.WarnLevel:   raven.WARNING,
+	zapcore.ErrorLevel:  raven.ERROR,
+	zapcore.DPanicLevel: raven.FATAL,
+	zapcore.PanicLevel:  raven.FATAL,
+	zapcore.FatalLevel:  raven.FATAL,
+}
+
+// sentryCore reports entries to sentry, based upon zapsentry.Core
+// Field keys and tags are handled the same way, so zapsentry.Skip and the "#" tag prefix keep working.
+// In addition, entries below the sentry level are recorded as breadcrumbs if the core has a breadcrumb buffer.
+type sentryCore struct {
+	state  *sentryState
+	level  zap.AtomicLevel
+	fields []zapcore.Field
+
+	crumbs     *breadcrumbBuffer
+	crumbLevel zapcore.Level
+
+	scope *sentryScope
+	meta  sentryMeta
+}
+
+func newSentryCore(state *sentryState, level zap.AtomicLevel, crumbLevel zapcore.Level, meta sentryMeta) *sentryCore {
+	return &sentryCore{
+		state:      state,
+		level:      level,
+		crumbLevel: crumbLevel,
+		meta:       meta,
+	}
+}
+
+// withBreadcrumbs returns a copy of the core recording into crumbs
+func (c *sentryCore) withBreadcrumbs(crumbs *breadcrumbBuffer) *sentryCore {
+	clone := *c
+	clone.crumbs = crumbs
+	return &clone
+}
+
+// withScope returns a copy of the core reporting with the scope returned by fn
+func (c *sentryCore) withScope(fn func(*sentryScope) *sentryScope) *sentryCore {
+	clone := *c
+	clone.scope = fn(c.scope)
+	return &clone
+}
+
+// Enabled returns true if lvl is reported or recorded as breadcrumb
+func (c *sentryCore) Enabled(lvl zapcore.Level) bool {
+	if c.level.Enabled(lvl) {
+		return true
+	}
+	return c.crumbs != nil && c.crumbLevel.Enabled(lvl)
+}
+
+// With adds fields to all events reported by the core
+// A meta field replaces the meta reported with every event
+func (c *sentryCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	if meta, ok := metaOf(fields); ok {
+		clone.meta = meta
+	}
+	clone.fields = make([]zapcore.Field, len(c.fields)+len(fields))
+	copy(clone.fields, c.fields)
+	copy(clone.fields[len(c.fields):], fields)
+	return &clone
+}
+
+// Check adds the core if the entry is being reported or recorded
+func (c *sentryCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write reports the entry to sentry or records it as breadcrumb if it is below the sentry level
+func (c *sentryCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if !c.level.Enabled(ent.Level) {
+		if c.crumbs != nil {
+			c.crumbs.add(newBreadcrumb(ent, c.fields, fields))
+		}
+		return nil
+	}
+
+	// entries at panic level and above are always reported, as the process is about to end
+	if ent.Level < zapcore.PanicLevel && !c.skipped(fields) {
+		if !c.state.limiter.sample() {
+			c.state.sampled.Inc()
+			return nil
+		}
+		if !c.state.limiter.allow(c, ent, fields) {
+			c.state.suppressed.Inc()
+			return nil
+		}
+	}
+
+	packet, ok := c.packet(ent, fields)
+	if !ok {
+		return nil
+	}
+
+	errCh, ok := c.state.capture(packet)
+	if ok && ent.Level >= zapcore.PanicLevel {
+		return <-errCh
+	}
+	return nil
+}
+
+// Sync waits for all captured events to be sent
+// As this blocks as long as sentry does not respond, Logger.Close should be used to bound it on shutdown
+func (c *sentryCore) Sync() error {
+	if c.state.isClosed() {
+		return nil
+	}
+	return c.state.reporter.Flush(context.Background())
+}
+
+// skipped returns true if the entry is marked using zapsentry.Skip
+func (c *sentryCore) skipped(fields []zapcore.Field) bool {
+	for _, field := range c.fields {
+		if field.Key == zapsentry.SkipKey {
+			return true
+		}
+	}
+	for _, field := range fields {
+		if field.Key == zapsentry.SkipKey {
+			return true
+		}
+	}
+	return false
+}
+
+// packet builds the raven.Packet for the entry, returning false if the entry should be skipped
+func (c *sentryCore) packet(ent zapcore.Entry, fields []zapcore.Field) (*raven.Packet, bool) {
+	packet := raven.NewPacket(ent.Message)
+	packet.Level = zapLevelToRavenSeverity[ent.Level]
+	packet.Timestamp = raven.Timestamp(ent.Time)
+	packet.Logger = ent.LoggerName
+	c.meta.apply(packet)
+
+	encoder := zapcore.NewMapObjectEncoder()
+
+	var (
+		err         error
+		req         *http.Request
+		fingerprint []string
+	)
+	if c.scope != nil {
+		req = c.scope.request
+	}
+
+	// processField handles the significant keys and returns false if the entry is to be skipped
+	processField := func(field zapcore.Field) bool {
+		switch field.Key {
+		case zapsentry.EventIDKey:
+			packet.EventID = field.String
+		case zapsentry.ProjectKey:
+			packet.Project = field.String
+		case zapsentry.PlatformKey:
+			packet.Platform = field.String
+		case zapsentry.CulpritKey:
+			packet.Culprit = field.String
+		case zapsentry.ServerNameKey:
+			packet.ServerName = field.String
+		case zapsentry.ErrorKey:
+			if ex, ok := field.Interface.(error); ok {
+				err = ex
+			} else {
+				field.AddTo(encoder)
+			}
+		case zapsentry.HTTPRequestKey:
+			switch r := field.Interface.(type) {
+			case *http.Request:
+				req = r
+			case types.HTTPRequest:
+				req = r.R
+			case *types.HTTPRequest:
+				req = r.R
+			default:
+				field.AddTo(encoder)
+			}
+		case zapsentry.SkipKey:
+			return false
+		case FingerprintKey:
+			if parts, ok := field.Interface.([]string); ok {
+				fingerprint = parts
+			}
+		default:
+			field.AddTo(encoder)
+		}
+		return true
+	}
+
+	// fields passed directly overwrite the core fields
+	for _, field := range c.fields {
+		if !processField(field) {
+			return nil, false
+		}
+	}
+	for _, field := range fields {
+		if !processField(field) {
+			return nil, false
+		}
+	}
+
+	tags := make(map[string]string)
+	if len(c.meta.dist) > 0 {
+		tags[sentryDistTag] = c.meta.dist
+	}
+	if c.scope != nil {
+		for key, value := range c.scope.tags {
+			tags[key] = value
+		}
+	}
+	for key, value := range encoder.Fields {
+		if strings.HasPrefix(key, zapsentry.TagPrefix) {
+			key = key[len(zapsentry.TagPrefix):]
+			if v, ok := value.(string); ok {
+				tags[key] = v
+			} else {
+				tags[key] = fmt.Sprintf("%v", value)
+			}
+			continue
+		}
+		packet.Extra[key] = value
+	}
+
+	stackTrace := trimLogFrames(raven.NewStacktrace(0, sentryStackTraceContext, nil))
+	if err != nil {
+		packet.Interfaces = append(packet.Interfaces, newExceptions(err, stackTrace))
+		if stackTracer, ok := err.(zapsentry.StackTracer); ok {
+			frames := stackTracer.StackTrace()
+			record := make([][]string, 0, len(frames))
+			for _, frame := range frames {
+				record = append(record, strings.Split(fmt.Sprintf("%+v", frame), "\n"))
+			}
+			packet.Extra[zapsentry.ErrorStackTraceKey] = record
+		}
+	} else {
+		packet.Interfaces = append(packet.Interfaces, stackTrace)
+	}
+
+	if req != nil {
+		packet.Interfaces = append(packet.Interfaces, raven.NewHttp(req))
+	}
+
+	if c.scope != nil && c.scope.user != nil {
+		user := *c.scope.user
+		packet.Interfaces = append(packet.Interfaces, &user)
+	}
+
+	if c.crumbs != nil {
+		if crumbs := c.crumbs.flush(); len(crumbs) > 0 {
+			packet.Interfaces = append(packet.Interfaces, &Breadcrumbs{Values: crumbs})
+		}
+	}
+
+	if len(tags) > 0 {
+		packet.AddTags(tags)
+	}
+
+	if len(fingerprint) > 0 {
+		packet.Fingerprint = fingerprint
+	} else {
+		packet.Fingerprint = defaultFingerprint(ent, err)
+	}
+
+	return packet, true
+}
+
+// withSentry returns a new logger with its sentry core replaced by the result of fn
+// Without sentry the logger is returned unchanged
+func (l *Logger) withSentry(fn func(*sentryCore) *sentryCore) *Logger {
+	if l.nop || l.Reporter == nil {
+		return l
+	}
+	return l.withRouting(func(c *routingCore) *routingCore {
+		return c.withSentry(fn)
+	})
+}
@@ -0,0 +1,174 @@
+package log_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getsentry/raven-go"
+	"github.com/seibert-media/golibs/log"
+	"github.com/seibert-media/golibs/logtest/sentrytest"
+	"github.com/tchap/zapext/zapsentry"
+	"go.uber.org/zap"
+)
+
+func breadcrumbs(packet *raven.Packet) []*log.Breadcrumb {
+	for _, i := range packet.Interfaces {
+		if crumbs, ok := i.(*log.Breadcrumbs); ok {
+			return crumbs.Values
+		}
+	}
+	return nil
+}
+
+func Test_SentryCore(t *testing.T) {
+	reporter := &recordingReporter{}
+	logger, _ := newTestLogger(t, log.OptErrorReporter(reporter))
+	logger = logger.WithFields(zap.String("#tag", "value"), zap.String("extra", "value"))
+	logger.Info("not reported")
+	logger.Error("reported", zap.Error(errors.New("test")))
+	logger.Error("skipped", zapsentry.Skip())
+	logger.Sync()
+
+	packets := reporter.Packets()
+	if len(packets) != 1 {
+		t.Fatal("exactly one packet should be sent, got:", len(packets))
+	}
+	packet := packets[0]
+	if packet.Message != "reported" || packet.Level != raven.ERROR {
+		t.Fatal("unexpected packet:", packet.Message, packet.Level)
+	}
+	if packet.Extra["extra"] != "value" {
+		t.Fatal("extra field missing, got:", packet.Extra)
+	}
+	if len(packet.Tags) != 1 || packet.Tags[0].Key != "tag" || packet.Tags[0].Value != "value" {
+		t.Fatal("tag missing, got:", packet.Tags)
+	}
+	exceptions, ok := interfaceOf(packet, "exception").(*raven.Exceptions)
+	if !ok || len(exceptions.Values) != 1 || exceptions.Values[0].Value != "test" {
+		t.Fatal("error should be reported as exception, got:", packet.Interfaces)
+	}
+}
+
+func Test_Breadcrumbs(t *testing.T) {
+	reporter := &recordingReporter{}
+	logger, _ := newTestLogger(t, log.OptErrorReporter(reporter), log.OptBreadcrumbLimit(2))
+	ctx := log.WithBreadcrumbs(logger.To(context.Background()))
+
+	log.From(ctx).Debug("first")
+	log.From(ctx).Named("db").WithFields(zap.String("request", "42")).Info("second", zap.String("query", "select"))
+	log.From(ctx).Warn("third")
+	logger.Info("other request")
+	log.From(ctx).Error("failed")
+	log.From(ctx).Error("failed again")
+	logger.Sync()
+
+	packets := reporter.Packets()
+	if len(packets) != 2 {
+		t.Fatal("two packets should be sent, got:", len(packets))
+	}
+	crumbs := breadcrumbs(packets[0])
+	if len(crumbs) != 2 {
+		t.Fatal("breadcrumbs should be limited to 2, got:", len(crumbs))
+	}
+	if crumbs[0].Message != "second" || crumbs[0].Category != "db" || crumbs[0].Level != raven.INFO {
+		t.Fatal("unexpected first breadcrumb:", crumbs[0])
+	}
+	if crumbs[0].Data["query"] != "select" || crumbs[0].Data["request"] != "42" {
+		t.Fatal("breadcrumb should contain fields, got:", crumbs[0].Data)
+	}
+	if crumbs[1].Message != "third" || crumbs[1].Level != raven.WARNING {
+		t.Fatal("unexpected second breadcrumb:", crumbs[1])
+	}
+	if len(breadcrumbs(packets[1])) != 0 {
+		t.Fatal("breadcrumbs should be cleared after an event")
+	}
+}
+
+func Test_BreadcrumbsLevel(t *testing.T) {
+	reporter := &recordingReporter{}
+	logger, _ := newTestLogger(t, log.OptErrorReporter(reporter), log.OptBreadcrumbLevel(zap.InfoLevel))
+	logger = logger.WithBreadcrumbs()
+	if logger.Core().Enabled(zap.DebugLevel) {
+		t.Fatal("debug should not be enabled")
+	}
+	logger.Debug("ignored")
+	logger.Info("recorded")
+	logger.Error("failed")
+	logger.Sync()
+
+	crumbs := breadcrumbs(reporter.Packets()[0])
+	if len(crumbs) != 1 || crumbs[0].Message != "recorded" {
+		t.Fatal("only info should be recorded, got:", crumbs)
+	}
+}
+
+func Test_WithoutBreadcrumbs(t *testing.T) {
+	reporter := &recordingReporter{}
+	logger, _ := newTestLogger(t, log.OptErrorReporter(reporter))
+	logger.Info("not recorded")
+	logger.Error("failed")
+	logger.Sync()
+
+	if crumbs := breadcrumbs(reporter.Packets()[0]); len(crumbs) != 0 {
+		t.Fatal("breadcrumbs should only be recorded for contexts using WithBreadcrumbs, got:", crumbs)
+	}
+	if log.NewNop().WithBreadcrumbs() == nil {
+		t.Fatal("nop logger should be returned")
+	}
+}
+
+func Test_BreadcrumbLimitInvalid(t *testing.T) {
+	if _, err := log.NewWithOptions(log.OptBreadcrumbLimit(-1)); err == nil {
+		t.Fatal("NewWithOptions() should have returned error for a negative breadcrumb limit")
+	}
+}
+
+func Test_BeforeSend(t *testing.T) {
+	server := sentrytest.NewServer()
+	defer server.Close()
+
+	logger, err := log.NewWithOptions(
+		log.OptLocal(true),
+		log.OptOutput(ioutil.Discard),
+		log.OptSentryDSN(server.DSN()),
+		log.OptBeforeSend(func(packet *raven.Packet) *raven.Packet {
+			if packet.Message == "dropped" {
+				return nil
+			}
+			for _, i := range packet.Interfaces {
+				if req, ok := i.(*raven.Http); ok {
+					delete(req.Headers, "Authorization")
+				}
+			}
+			packet.AddTags(map[string]string{"pod": "app-1"})
+			return packet
+		}),
+	)
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Accept", "text/plain")
+	log.From(log.WithSentryRequest(logger.To(context.Background()), req)).Error("scrubbed")
+	logger.Error("dropped")
+	logger.Sync()
+
+	event := server.AssertEvent(t, "scrubbed", raven.ERROR)
+	if _, ok := event.Request.Headers["Authorization"]; ok || event.Request.Headers["Accept"] != "text/plain" {
+		t.Fatal("authorization header should be removed, got:", event.Request.Headers)
+	}
+	if pod, _ := event.Tag("pod"); pod != "app-1" {
+		t.Fatal("tag should be added, got:", event.Tags)
+	}
+	if len(server.Events()) != 1 {
+		t.Fatal("dropped event should not be sent, got:", len(server.Events()))
+	}
+	if stats := logger.SentryStats(); stats.Filtered != 1 || stats.Captured != 1 {
+		t.Fatal("filtered events miscounted:", stats)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+// +build !unix
+
+package log
+
+import (
+	"context"
+)
+
+// HandleSignals is not supported on this platform as SIGUSR1 and SIGUSR2 do not exist
+func (l *Logger) HandleSignals(ctx context.Context, sinks ...Sink) {}
@@ -0,0 +1,65 @@
+//go:build unix
+// +build unix
+
+package log
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// HandleSignals changes the level of the passed in sinks on SIGUSR1 and SIGUSR2 until ctx is done, logging each change like LevelHandler does
+// SIGUSR1 switches to Debug, SIGUSR2 switches back to the level configured when calling HandleSignals
+// If no sinks are passed, the console or stackdriver output is being changed
+func (l *Logger) HandleSignals(ctx context.Context, sinks ...Sink) {
+	if len(sinks) == 0 {
+		sinks = []Sink{l.outputSink()}
+	}
+
+	configured := make(map[Sink]zapcore.Level)
+	for _, sink := range sinks {
+		if level, ok := l.SinkLevel(sink); ok {
+			configured[sink] = level.Level()
+		}
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-signals:
+				for sink, original := range configured {
+					to := original
+					if sig == syscall.SIGUSR1 {
+						to = zapcore.DebugLevel
+					}
+					l.switchLevel(sink, to, sig)
+				}
+			}
+		}
+	}()
+}
+
+func (l *Logger) switchLevel(sink Sink, to zapcore.Level, sig os.Signal) {
+	level, _ := l.SinkLevel(sink)
+	from := level.Level()
+	if from == to {
+		return
+	}
+	l.changeLevel(level, to, "log level changed",
+		zap.String("sink", string(sink)),
+		zap.Stringer("from", from),
+		zap.Stringer("to", to),
+		zap.Stringer("signal", sig),
+	)
+}
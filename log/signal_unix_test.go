@@ -0,0 +1,85 @@
+//go:build unix
+// +build unix
+
+package log_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/seibert-media/golibs/log"
+	"go.uber.org/zap"
+)
+
+func Test_HandleSignals(t *testing.T) {
+	buf := &syncBuffer{}
+	logger, err := log.NewWithOptions(
+		log.OptLocal(true),
+		log.OptOutput(buf),
+		log.OptSentryDSN("http://test@localhost/test"),
+	)
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger.HandleSignals(ctx, log.SinkConsole, log.SinkSentry)
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal("sending signal failed with:", err)
+	}
+	sentry, _ := logger.SinkLevel(log.SinkSentry)
+	debug := waitFor(func() bool {
+		return logger.Level.Level() == zap.DebugLevel && sentry.Level() == zap.DebugLevel
+	})
+	if !debug {
+		t.Fatal("levels should be debug, got:", logger.Level.Level(), sentry.Level())
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal("sending signal failed with:", err)
+	}
+	reset := waitFor(func() bool {
+		return logger.Level.Level() == zap.InfoLevel && sentry.Level() == zap.ErrorLevel
+	})
+	if !reset {
+		t.Fatal("levels should be reset, got:", logger.Level.Level(), sentry.Level())
+	}
+	if !strings.Contains(buf.String(), "log level changed") {
+		t.Fatal("changes should be logged, got:", buf.String())
+	}
+}
+
+func Test_HandleSignalsRestoreLogged(t *testing.T) {
+	buf := &syncBuffer{}
+	logger, err := log.NewWithOptions(
+		log.OptLocal(true),
+		log.OptOutput(buf),
+		log.OptAtomicLevel(zap.NewAtomicLevelAt(zap.ErrorLevel)),
+	)
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger.HandleSignals(ctx)
+
+	for _, sig := range []syscall.Signal{syscall.SIGUSR1, syscall.SIGUSR2} {
+		count := strings.Count(buf.String(), "log level changed")
+		if err := syscall.Kill(os.Getpid(), sig); err != nil {
+			t.Fatal("sending signal failed with:", err)
+		}
+		logged := waitFor(func() bool {
+			return strings.Count(buf.String(), "log level changed") == count+1
+		})
+		if !logged {
+			t.Fatalf("change on %s should be logged, got: %s", sig, buf.String())
+		}
+	}
+	if logger.Level.Level() != zap.ErrorLevel {
+		t.Fatal("level should be restored to error, got:", logger.Level.Level())
+	}
+}
@@ -0,0 +1,68 @@
+package log
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Sink identifies a log destination with its own level
+type Sink string
+
+// Available sinks, console and stackdriver are exclusive depending on local mode
+const (
+	SinkConsole     Sink = "console"
+	SinkStackdriver Sink = "stackdriver"
+	SinkSentry      Sink = "sentry"
+	SinkFile        Sink = "file"
+)
+
+// defaultSinkLevels are used for sinks without an explicitly configured level
+var defaultSinkLevels = map[Sink]zapcore.Level{
+	SinkConsole:     zapcore.InfoLevel,
+	SinkStackdriver: zapcore.InfoLevel,
+	SinkSentry:      zapcore.ErrorLevel,
+	SinkFile:        zapcore.InfoLevel,
+}
+
+// Sinks returns all sinks configured for the Logger
+func (l *Logger) Sinks() []Sink {
+	sinks := make([]Sink, 0, len(l.levels))
+	for sink := range l.levels {
+		sinks = append(sinks, sink)
+	}
+	sort.Slice(sinks, func(i, j int) bool { return sinks[i] < sinks[j] })
+	return sinks
+}
+
+// SinkLevel returns the level of sink and whether the sink is configured
+func (l *Logger) SinkLevel(sink Sink) (zap.AtomicLevel, bool) {
+	level, ok := l.levels[sink]
+	return level, ok
+}
+
+// SetSinkLevel changes the level of sink for the Logger and all loggers derived from it
+func (l *Logger) SetSinkLevel(sink Sink, to zapcore.Level) error {
+	level, ok := l.levels[sink]
+	if !ok {
+		return errors.Errorf("sink %q is not configured", sink)
+	}
+	level.SetLevel(to)
+	return nil
+}
+
+// SetSinkLevel of the logger stored in ctx
+func SetSinkLevel(ctx context.Context, sink Sink, to zapcore.Level) error {
+	return From(ctx).SetSinkLevel(sink, to)
+}
+
+// outputSink returns the console or stackdriver sink depending on local mode
+func (l *Logger) outputSink() Sink {
+	if l.local {
+		return SinkConsole
+	}
+	return SinkStackdriver
+}
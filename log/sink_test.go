@@ -0,0 +1,105 @@
+package log_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/seibert-media/golibs/log"
+	"go.uber.org/zap"
+)
+
+func Test_Sinks(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	logger, err := log.NewWithOptions(
+		log.OptLocal(true),
+		log.OptOutput(ioutil.Discard),
+		log.OptSentryDSN("http://test@localhost/test"),
+		log.OptFile(log.FileConfig{Path: filepath.Join(dir, "test.log")}),
+	)
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+	defer logger.File.Close()
+
+	expected := []log.Sink{log.SinkConsole, log.SinkFile, log.SinkSentry}
+	if sinks := logger.Sinks(); !reflect.DeepEqual(sinks, expected) {
+		t.Fatal("unexpected sinks:", sinks)
+	}
+
+	level, ok := logger.SinkLevel(log.SinkConsole)
+	if !ok || level != logger.Level {
+		t.Fatal("console sink should use the logger level")
+	}
+	if level, _ := logger.SinkLevel(log.SinkSentry); level.Level() != zap.ErrorLevel {
+		t.Fatal("sentry level should default to error, got:", level.Level())
+	}
+	if _, ok := logger.SinkLevel(log.SinkStackdriver); ok {
+		t.Fatal("stackdriver sink should not be configured in local mode")
+	}
+	if err := logger.SetSinkLevel(log.SinkStackdriver, zap.DebugLevel); err == nil {
+		t.Fatal("setting level of unconfigured sink should return error")
+	}
+}
+
+func Test_SetSinkLevel(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	var buf bytes.Buffer
+	path := filepath.Join(dir, "test.log")
+	logger, err := log.NewWithOptions(
+		log.OptLocal(true),
+		log.OptOutput(&buf),
+		log.OptFile(log.FileConfig{Path: path}),
+		log.OptSentryDSN("http://test@localhost/test"),
+	)
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+	ctx := logger.WithFields(zap.String("test", "test")).To(context.Background())
+
+	if err := log.SetSinkLevel(ctx, log.SinkFile, zap.DebugLevel); err != nil {
+		t.Fatal("setting file level failed with:", err)
+	}
+	if err := logger.SetSinkLevel(log.SinkSentry, zap.WarnLevel); err != nil {
+		t.Fatal("setting sentry level failed with:", err)
+	}
+	if !logger.Core().Enabled(zap.DebugLevel) {
+		t.Fatal("logger should be enabled for debug through the file sink")
+	}
+
+	log.From(ctx).Debug("debug message")
+	logger.File.Close()
+
+	if strings.Contains(buf.String(), "debug message") {
+		t.Fatal("console should not print debug, got:", buf.String())
+	}
+	content, _ := ioutil.ReadFile(path)
+	if !strings.Contains(string(content), "debug message") {
+		t.Fatal("file should contain debug message, got:", string(content))
+	}
+	if level, _ := logger.SinkLevel(log.SinkSentry); level.Level() != zap.WarnLevel {
+		t.Fatal("sentry level should be warn, got:", level.Level())
+	}
+}
+
+func Test_WithSinkLevel(t *testing.T) {
+	logger, err := log.NewWithOptions(
+		log.OptLocal(false),
+		log.OptOutput(ioutil.Discard),
+		log.OptSinkLevel(log.SinkStackdriver, zap.NewAtomicLevelAt(zap.WarnLevel)),
+	)
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+	if logger.Level.Level() != zap.WarnLevel {
+		t.Fatal("stackdriver level should be the logger level, got:", logger.Level.Level())
+	}
+}
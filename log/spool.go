@@ -0,0 +1,292 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getsentry/raven-go"
+	"github.com/pkg/errors"
+)
+
+// SpoolConfig configures the disk spool for sentry events failing to be sent
+type SpoolConfig struct {
+	// Dir the events are stored in, it is created if missing
+	Dir string
+	// MaxBytes of all stored events, the oldest events are removed to stay below, defaults to 10 MiB
+	MaxBytes int64
+	// MinBackoff before retrying to send the stored events, defaults to one second
+	MinBackoff time.Duration
+	// MaxBackoff the retry interval is doubled up to, defaults to five minutes
+	MaxBackoff time.Duration
+}
+
+// Spool defaults
+const (
+	DefaultSpoolMaxBytes   = 10 << 20
+	DefaultSpoolMinBackoff = time.Second
+	DefaultSpoolMaxBackoff = 5 * time.Minute
+)
+
+// errSpooled is returned by the spool transport for events stored to be sent later
+var errSpooled = errors.New("sentry event spooled")
+
+const (
+	spoolExt      = ".json"
+	quarantineExt = ".invalid"
+)
+
+// sentrySpool stores events which failed to be sent in a directory
+// Stored events are retried with exponential backoff using post, including those left over from previous runs
+type sentrySpool struct {
+	config SpoolConfig
+	post   func(data []byte) error
+	// errorOutput receives failures of the background replay
+	errorOutput io.Writer
+
+	// mu guards the files in the directory
+	mu   sync.Mutex
+	wake chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newSentrySpool(config SpoolConfig, post func(data []byte) error, errorOutput io.Writer) (*sentrySpool, error) {
+	if len(config.Dir) == 0 {
+		return nil, errors.New("sentry spool requires a directory")
+	}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = DefaultSpoolMaxBytes
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = DefaultSpoolMinBackoff
+	}
+	if config.MaxBackoff < config.MinBackoff {
+		config.MaxBackoff = DefaultSpoolMaxBackoff
+		if config.MaxBackoff < config.MinBackoff {
+			config.MaxBackoff = config.MinBackoff
+		}
+	}
+
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "creating sentry spool directory")
+	}
+
+	s := &sentrySpool{
+		config:      config,
+		post:        post,
+		errorOutput: errorOutput,
+		wake:        make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.run()
+	return s, nil
+}
+
+// handle stores the event payload data if sending it failed temporarily with err
+// errSpooled is returned for stored events, err otherwise
+func (s *sentrySpool) handle(id string, data []byte, err error) error {
+	if err == nil || !retryable(err) {
+		return err
+	}
+	if storeErr := s.store(id, data); storeErr != nil {
+		return errors.Wrapf(err, "spooling failed with %v", storeErr)
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return errSpooled
+}
+
+// Close stops retrying, stored events are kept for the next start
+func (s *sentrySpool) Close() {
+	close(s.done)
+	s.wg.Wait()
+}
+
+func (s *sentrySpool) run() {
+	defer s.wg.Done()
+
+	backoff := s.config.MinBackoff
+	// replay the events of previous runs right away
+	timer := time.NewTimer(0)
+	armed := true
+
+	for {
+		select {
+		case <-s.done:
+			timer.Stop()
+			return
+		case <-s.wake:
+			if !armed {
+				timer.Reset(backoff)
+				armed = true
+			}
+		case <-timer.C:
+			if s.replay() {
+				backoff = s.config.MinBackoff
+				armed = false
+				continue
+			}
+			backoff *= 2
+			if backoff > s.config.MaxBackoff {
+				backoff = s.config.MaxBackoff
+			}
+			timer.Reset(backoff)
+		}
+	}
+}
+
+// replay sends the stored events oldest first, returning false if sending failed temporarily
+func (s *sentrySpool) replay() bool {
+	files, err := s.files()
+	if err != nil {
+		fmt.Fprintf(s.errorOutput, "log: listing sentry spool failed: %v\n", err)
+		return false
+	}
+
+	for _, file := range files {
+		select {
+		case <-s.done:
+			return true
+		default:
+		}
+
+		data, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			// removed to stay below the size limit
+			continue
+		}
+		if err == nil && !json.Valid(data) {
+			err = errors.New("invalid json")
+		}
+		if err != nil {
+			// unreadable files must not block the following events
+			s.quarantine(file, err)
+			continue
+		}
+
+		err = s.post(data)
+		if err != nil && retryable(err) {
+			return false
+		}
+		if err != nil {
+			fmt.Fprintf(s.errorOutput, "log: dropping spooled sentry event %s: %v\n", filepath.Base(file), err)
+		}
+		s.mu.Lock()
+		os.Remove(file)
+		s.mu.Unlock()
+	}
+	return true
+}
+
+// quarantine renames a stored event which cannot be read, so it is kept for inspection but not replayed again
+func (s *sentrySpool) quarantine(file string, err error) {
+	fmt.Fprintf(s.errorOutput, "log: skipping spooled sentry event %s: %v\n", filepath.Base(file), err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if renameErr := os.Rename(file, file+quarantineExt); renameErr != nil {
+		os.Remove(file)
+	}
+}
+
+// spoolTransport is a raven.Transport storing packets in the spool if sending them through Transport failed
+type spoolTransport struct {
+	raven.Transport
+	spool *sentrySpool
+}
+
+// Send implements raven.Transport
+func (t *spoolTransport) Send(url, authHeader string, packet *raven.Packet) error {
+	err := t.Transport.Send(url, authHeader, packet)
+	if err == nil || !retryable(err) {
+		return err
+	}
+	data, jsonErr := packet.JSON()
+	if jsonErr != nil {
+		return err
+	}
+	return t.spool.handle(packet.EventID, data, err)
+}
+
+// store writes data to the directory, removing the oldest events to stay below the size limit
+func (s *sentrySpool) store(id string, data []byte) error {
+	size := int64(len(data))
+	if size > s.config.MaxBytes {
+		return errors.Errorf("event of %d bytes exceeds the spool size", size)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+	sizes := make([]int64, len(files))
+	total := size
+	for i, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+	for i := 0; total > s.config.MaxBytes && i < len(files); i++ {
+		if err := os.Remove(files[i]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= sizes[i]
+	}
+
+	name := filepath.Join(s.config.Dir, fmt.Sprintf("%020d-%s", time.Now().UnixNano(), id))
+	if err := ioutil.WriteFile(name+".tmp", data, 0644); err != nil {
+		os.Remove(name + ".tmp")
+		return err
+	}
+	return os.Rename(name+".tmp", name+spoolExt)
+}
+
+// files returns the stored events, oldest first
+func (s *sentrySpool) files() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.config.Dir, "*"+spoolExt))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// retryable returns true for network errors, rate limits and server errors
+// All other errors are permanent, as the event would be rejected again
+func retryable(err error) bool {
+	code := 0
+	switch e := errors.Cause(err).(type) {
+	case *statusError:
+		code = e.code
+	case *url.Error, net.Error:
+		return true
+	default:
+		// raven.HTTPTransport reports the status as text only
+		const prefix = "raven: got http status "
+		if !strings.HasPrefix(e.Error(), prefix) {
+			return false
+		}
+		code, _ = strconv.Atoi(strings.TrimPrefix(e.Error(), prefix))
+	}
+	return code == http.StatusTooManyRequests || code >= 500
+}
@@ -0,0 +1,172 @@
+package log_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getsentry/raven-go"
+	"github.com/seibert-media/golibs/log"
+	"github.com/seibert-media/golibs/logtest/sentrytest"
+)
+
+func spooled(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal("listing spool failed with:", err)
+	}
+	return files
+}
+
+func Test_SentrySpool(t *testing.T) {
+	server := sentrytest.NewServer()
+	defer server.Close()
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	server.Fail(http.StatusServiceUnavailable)
+	logger, _ := newTestLogger(t, log.OptSentryDSN(server.DSN()), log.OptSentrySpool(log.SpoolConfig{Dir: dir, MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond}))
+	defer logger.Close(context.Background())
+
+	logger.Error("offline")
+	logger.Sync()
+	if stats := logger.SentryStats(); stats.Spooled != 1 || stats.Failed != 0 || stats.Pending() != 0 {
+		t.Fatal("event should be spooled, got:", stats)
+	}
+	if len(spooled(t, dir)) != 1 {
+		t.Fatal("event should be stored")
+	}
+
+	if !waitFor(func() bool { return server.Attempts() > 3 }) {
+		t.Fatal("spooled event should be retried, got attempts:", server.Attempts())
+	}
+
+	server.Fail(0)
+	server.AssertEvent(t, "offline", raven.ERROR)
+	if !waitFor(func() bool { return len(spooled(t, dir)) == 0 }) {
+		t.Fatal("sent event should be removed from the spool")
+	}
+}
+
+func Test_SentrySpoolReplay(t *testing.T) {
+	server := sentrytest.NewServer()
+	defer server.Close()
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	server.Fail(http.StatusBadGateway)
+	logger, _ := newTestLogger(t, log.OptSentryDSN(server.DSN()), log.OptSentrySpool(log.SpoolConfig{Dir: dir, MinBackoff: time.Hour}))
+	logger.Error("before restart")
+	if err := logger.Close(context.Background()); err != nil {
+		t.Fatal("spooled events should not be reported as dropped, got:", err)
+	}
+	if len(spooled(t, dir)) != 1 {
+		t.Fatal("event should be kept after close")
+	}
+
+	server.Fail(0)
+	errs := &syncBuffer{}
+	logger, _ = newTestLogger(t,
+		log.OptSentryDSN(server.DSN()),
+		log.OptSentrySpool(log.SpoolConfig{Dir: dir, MinBackoff: time.Hour}),
+		log.OptErrorOutput(errs),
+	)
+	defer logger.Close(context.Background())
+
+	event := server.AssertEvent(t, "before restart", raven.ERROR)
+	if len(event.Raw["exception"]) == 0 && len(event.Raw["stacktrace"]) == 0 {
+		t.Fatal("replayed event should keep its interfaces, got:", event.Raw)
+	}
+}
+
+func Test_SentrySpoolUnreadable(t *testing.T) {
+	server := sentrytest.NewServer()
+	defer server.Close()
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	server.Fail(http.StatusBadGateway)
+	logger, _ := newTestLogger(t, log.OptSentryDSN(server.DSN()), log.OptSentrySpool(log.SpoolConfig{Dir: dir, MinBackoff: time.Hour}))
+	logger.Error("after invalid files")
+	logger.Close(context.Background())
+
+	// stored before the event, so they are replayed first
+	if err := os.Mkdir(filepath.Join(dir, "00000000000000000001-unreadable.json"), 0755); err != nil {
+		t.Fatal("creating directory failed with:", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "00000000000000000002-corrupt.json"), []byte("{"), 0644); err != nil {
+		t.Fatal("writing file failed with:", err)
+	}
+
+	server.Fail(0)
+	errs := &syncBuffer{}
+	logger, _ = newTestLogger(t,
+		log.OptSentryDSN(server.DSN()),
+		log.OptSentrySpool(log.SpoolConfig{Dir: dir, MinBackoff: time.Hour}),
+		log.OptErrorOutput(errs),
+	)
+	defer logger.Close(context.Background())
+
+	server.AssertEvent(t, "after invalid files", raven.ERROR)
+	if !waitFor(func() bool { return len(spooled(t, dir)) == 0 }) {
+		t.Fatal("invalid files should not be replayed again, got:", spooled(t, dir))
+	}
+	invalid, _ := filepath.Glob(filepath.Join(dir, "*.invalid"))
+	if len(invalid) != 2 {
+		t.Fatal("invalid files should be kept for inspection, got:", invalid)
+	}
+	if strings.Count(errs.String(), "skipping spooled sentry event") != 2 {
+		t.Fatal("skipped files should be reported to the error output, got:", errs.String())
+	}
+}
+
+func Test_SentrySpoolMaxBytes(t *testing.T) {
+	server := sentrytest.NewServer()
+	defer server.Close()
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	server.Fail(http.StatusInternalServerError)
+	logger, _ := newTestLogger(t, log.OptSentryDSN(server.DSN()), log.OptSentrySpool(log.SpoolConfig{Dir: dir, MaxBytes: 12 << 10, MinBackoff: time.Hour}))
+	defer logger.Close(context.Background())
+
+	for i := 0; i < 10; i++ {
+		logger.Error("offline")
+	}
+	logger.Sync()
+
+	files := spooled(t, dir)
+	var total int64
+	for _, file := range files {
+		data, _ := ioutil.ReadFile(file)
+		total += int64(len(data))
+	}
+	if len(files) == 0 || len(files) == 10 || total > 12<<10 {
+		t.Fatal("spool should be limited in size, got files:", len(files), "bytes:", total)
+	}
+}
+
+func Test_SentrySpoolPermanentFailure(t *testing.T) {
+	server := sentrytest.NewServer()
+	defer server.Close()
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	server.Fail(http.StatusBadRequest)
+	logger, _ := newTestLogger(t, log.OptSentryDSN(server.DSN()), log.OptSentrySpool(log.SpoolConfig{Dir: dir}))
+	defer logger.Close(context.Background())
+
+	logger.Error("rejected")
+	logger.Sync()
+	if stats := logger.SentryStats(); stats.Failed != 1 || stats.Spooled != 0 {
+		t.Fatal("rejected events should not be spooled, got:", stats)
+	}
+	if len(spooled(t, dir)) != 0 {
+		t.Fatal("rejected event should not be stored")
+	}
+}
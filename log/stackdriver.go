@@ -0,0 +1,304 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blendle/zapdriver"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Keys of the stackdriver fields rendered compactly in local mode
+const (
+	LabelsKey      = "logging.googleapis.com/labels"
+	OperationKey   = "logging.googleapis.com/operation"
+	HTTPRequestKey = "httpRequest"
+)
+
+// labelPrefix marks the fields created by zapdriver.Label
+const labelPrefix = "labels."
+
+// stackdriverLabels are sorted when encoded, so entries with the same labels print the same
+type stackdriverLabels map[string]string
+
+// MarshalLogObject implements zapcore.ObjectMarshaler
+func (l stackdriverLabels) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for _, key := range l.keys() {
+		enc.AddString(key, l[key])
+	}
+	return nil
+}
+
+func (l stackdriverLabels) keys() []string {
+	keys := make([]string, 0, len(l))
+	for key := range l {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// merge returns a new map containing l overwritten by labels
+func (l stackdriverLabels) merge(labels map[string]string) stackdriverLabels {
+	merged := make(stackdriverLabels, len(l)+len(labels))
+	for key, value := range l {
+		merged[key] = value
+	}
+	for key, value := range labels {
+		merged[key] = value
+	}
+	return merged
+}
+
+// WithLabels returns a context whose logger adds labels to all entries
+func WithLabels(ctx context.Context, labels map[string]string) context.Context {
+	return WithLogger(ctx, From(ctx).WithLabels(labels))
+}
+
+// WithLabels returns a new logger adding labels to all entries
+// Labels are merged with the ones already set and with fields created by zapdriver.Label
+func (l *Logger) WithLabels(labels map[string]string) *Logger {
+	return l.WithFields(zap.Object(LabelsKey, stackdriverLabels(nil).merge(labels)))
+}
+
+// Operation groups entries of a potentially long-running operation
+// The embedded Logger marks its entries as the first of the operation
+type Operation struct {
+	*Logger
+
+	parent   *Logger
+	id       string
+	producer string
+}
+
+// StartOperation returns an operation identified by id and producer
+// The combination of id and producer should be globally unique
+func (l *Logger) StartOperation(id, producer string) *Operation {
+	return &Operation{
+		Logger:   l.WithFields(zapdriver.OperationStart(id, producer)),
+		parent:   l,
+		id:       id,
+		producer: producer,
+	}
+}
+
+// Cont returns a logger marking its entries as part of the operation
+func (o *Operation) Cont() *Logger {
+	return o.parent.WithFields(zapdriver.OperationCont(o.id, o.producer))
+}
+
+// End returns a logger marking its entries as the last of the operation
+func (o *Operation) End() *Logger {
+	return o.parent.WithFields(zapdriver.OperationEnd(o.id, o.producer))
+}
+
+// HTTPRequest returns a new logger adding req and res as stackdriver http request to all entries
+// Unlike zapdriver.NewHTTP the bodies are not read, their sizes are taken from the content length
+func (l *Logger) HTTPRequest(req *http.Request, res *http.Response) *Logger {
+	return l.WithFields(zapdriver.HTTP(newHTTPPayload(req, res)))
+}
+
+func newHTTPPayload(req *http.Request, res *http.Response) *zapdriver.HTTPPayload {
+	payload := &zapdriver.HTTPPayload{}
+	if req != nil {
+		payload.RequestMethod = req.Method
+		payload.UserAgent = req.UserAgent()
+		payload.RemoteIP = remoteIP(req.RemoteAddr)
+		payload.Referer = req.Referer()
+		payload.Protocol = req.Proto
+		if req.URL != nil {
+			payload.RequestURL = req.URL.String()
+		}
+		if req.ContentLength > 0 {
+			payload.RequestSize = strconv.FormatInt(req.ContentLength, 10)
+		}
+	}
+	if res != nil {
+		payload.Status = res.StatusCode
+		if res.ContentLength >= 0 {
+			payload.ResponseSize = strconv.FormatInt(res.ContentLength, 10)
+		}
+	}
+	return payload
+}
+
+// remoteIP strips the port from addr if present
+func remoteIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// stackdriverCore merges all label fields into a single labels field
+// In local mode labels, operations and http requests are rendered as short strings instead of nested objects
+type stackdriverCore struct {
+	zapcore.Core
+	labels stackdriverLabels
+	local  bool
+}
+
+func newStackdriverCore(core zapcore.Core, local bool) zapcore.Core {
+	return &stackdriverCore{Core: core, local: local}
+}
+
+// With keeps the labels to be merged with the ones of each entry
+func (c *stackdriverCore) With(fields []zapcore.Field) zapcore.Core {
+	labels, fields := extractLabels(fields)
+	clone := &stackdriverCore{labels: c.labels, local: c.local}
+	if len(labels) > 0 {
+		clone.labels = c.labels.merge(labels)
+	}
+	clone.Core = c.Core.With(c.render(fields))
+	return clone
+}
+
+// Check adds the core if the wrapped core is enabled
+func (c *stackdriverCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write adds the merged labels to the entry
+func (c *stackdriverCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	labels, fields := extractLabels(fields)
+	if len(labels) > 0 {
+		labels = c.labels.merge(labels)
+	} else {
+		labels = c.labels
+	}
+	if len(labels) > 0 {
+		fields = append(fields, zap.Object(LabelsKey, stackdriverLabels(labels)))
+	}
+	return c.Core.Write(ent, c.render(fields))
+}
+
+// extractLabels removes all label fields, returning their merged labels
+func extractLabels(fields []zapcore.Field) (map[string]string, []zapcore.Field) {
+	var (
+		labels map[string]string
+		out    = fields[:0:0]
+	)
+	for _, field := range fields {
+		switch {
+		case field.Key == LabelsKey && field.Type == zapcore.ObjectMarshalerType:
+			l, ok := field.Interface.(stackdriverLabels)
+			if !ok {
+				out = append(out, field)
+				continue
+			}
+			if labels == nil {
+				labels = make(map[string]string)
+			}
+			for key, value := range l {
+				labels[key] = value
+			}
+		case strings.HasPrefix(field.Key, labelPrefix) && field.Type == zapcore.StringType:
+			if labels == nil {
+				labels = make(map[string]string)
+			}
+			labels[strings.TrimPrefix(field.Key, labelPrefix)] = field.String
+		default:
+			out = append(out, field)
+		}
+	}
+	return labels, out
+}
+
+// render replaces the stackdriver fields by short strings in local mode
+func (c *stackdriverCore) render(fields []zapcore.Field) []zapcore.Field {
+	if !c.local {
+		return fields
+	}
+	var rendered []zapcore.Field
+	for i, field := range fields {
+		compact, ok := renderField(field)
+		if !ok {
+			continue
+		}
+		if rendered == nil {
+			rendered = append(rendered, fields...)
+		}
+		rendered[i] = compact
+	}
+	if rendered == nil {
+		return fields
+	}
+	return rendered
+}
+
+// renderField returns the local representation of a stackdriver field
+func renderField(field zapcore.Field) (zapcore.Field, bool) {
+	if field.Type != zapcore.ObjectMarshalerType {
+		return field, false
+	}
+	var render func(map[string]interface{}) string
+	switch field.Key {
+	case LabelsKey:
+		if labels, ok := field.Interface.(stackdriverLabels); ok {
+			return zap.String("labels", renderLabels(labels)), true
+		}
+		return field, false
+	case OperationKey:
+		render = renderOperation
+	case HTTPRequestKey:
+		render = renderHTTPRequest
+	default:
+		return field, false
+	}
+
+	marshaler, ok := field.Interface.(zapcore.ObjectMarshaler)
+	if !ok {
+		return field, false
+	}
+	enc := zapcore.NewMapObjectEncoder()
+	if err := marshaler.MarshalLogObject(enc); err != nil {
+		return field, false
+	}
+	key := strings.TrimPrefix(field.Key, "logging.googleapis.com/")
+	if field.Key == HTTPRequestKey {
+		key = "http"
+	}
+	return zap.String(key, render(enc.Fields)), true
+}
+
+// renderLabels prints labels as "key=value" pairs
+func renderLabels(labels stackdriverLabels) string {
+	pairs := make([]string, 0, len(labels))
+	for _, key := range labels.keys() {
+		pairs = append(pairs, key+"="+labels[key])
+	}
+	return strings.Join(pairs, " ")
+}
+
+// renderOperation prints an operation as "producer/id", followed by its position if first or last
+func renderOperation(op map[string]interface{}) string {
+	s := fmt.Sprintf("%v/%v", op["producer"], op["id"])
+	if first, _ := op["first"].(bool); first {
+		s += " start"
+	}
+	if last, _ := op["last"].(bool); last {
+		s += " end"
+	}
+	return s
+}
+
+// renderHTTPRequest prints a request as "METHOD url status", followed by its latency if set
+func renderHTTPRequest(req map[string]interface{}) string {
+	parts := []string{fmt.Sprint(req["requestMethod"]), fmt.Sprint(req["requestUrl"])}
+	if status, _ := req["status"].(int); status != 0 {
+		parts = append(parts, strconv.Itoa(status))
+	}
+	if latency, _ := req["latency"].(string); len(latency) > 0 {
+		parts = append(parts, latency)
+	}
+	return strings.Join(parts, " ")
+}
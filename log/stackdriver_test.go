@@ -0,0 +1,85 @@
+package log_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/blendle/zapdriver"
+	"github.com/seibert-media/golibs/log"
+)
+
+func Test_WithLabels(t *testing.T) {
+	logger, buf := newTestLogger(t, log.OptLocal(false))
+	ctx := log.WithLabels(logger.To(context.Background()), map[string]string{"app": "shop", "env": "dev"})
+	log.From(ctx).WithLabels(map[string]string{"env": "prod"}).Info("labeled", zapdriver.Label("tenant", "42"))
+
+	entries := decodeEntries(t, buf)
+	labels, ok := entries[0][log.LabelsKey].(map[string]interface{})
+	if !ok || len(labels) != 3 || labels["app"] != "shop" || labels["env"] != "prod" || labels["tenant"] != "42" {
+		t.Fatal("labels should be merged into a single field, got:", entries[0])
+	}
+	if _, ok := entries[0]["labels.tenant"]; ok {
+		t.Fatal("zapdriver labels should be merged, got:", entries[0])
+	}
+}
+
+func Test_Operation(t *testing.T) {
+	logger, buf := newTestLogger(t, log.OptLocal(false))
+	op := logger.StartOperation("import-42", "importer")
+	op.Info("started")
+	op.Cont().Info("progress")
+	op.End().Info("done")
+
+	entries := decodeEntries(t, buf)
+	if len(entries) != 3 {
+		t.Fatal("three entries should be written, got:", len(entries))
+	}
+	for i, expected := range []struct{ first, last bool }{{true, false}, {false, false}, {false, true}} {
+		operation, ok := entries[i][log.OperationKey].(map[string]interface{})
+		if !ok || operation["id"] != "import-42" || operation["producer"] != "importer" ||
+			operation["first"] != expected.first || operation["last"] != expected.last {
+			t.Fatal("unexpected operation:", entries[i])
+		}
+	}
+}
+
+func Test_HTTPRequest(t *testing.T) {
+	logger, buf := newTestLogger(t, log.OptLocal(false))
+	req := httptest.NewRequest("POST", "http://example.com/orders", strings.NewReader("body"))
+	req.RemoteAddr = "10.0.0.1:1234"
+	logger.HTTPRequest(req, &http.Response{StatusCode: 201, ContentLength: 12}).Info("handled")
+
+	payload, ok := decodeEntries(t, buf)[0][log.HTTPRequestKey].(map[string]interface{})
+	if !ok || payload["requestMethod"] != "POST" || payload["requestUrl"] != "http://example.com/orders" ||
+		payload["status"] != float64(201) || payload["requestSize"] != "4" || payload["responseSize"] != "12" ||
+		payload["remoteIP"] != "10.0.0.1" {
+		t.Fatal("unexpected http request:", payload)
+	}
+	if req.ContentLength != 4 {
+		t.Fatal("request body should not be read")
+	}
+}
+
+func Test_StackdriverFieldsLocal(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger, err := log.NewWithOptions(log.OptLocal(true), log.OptOutput(buf))
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	logger.WithLabels(map[string]string{"b": "2", "a": "1"}).
+		StartOperation("import-42", "importer").
+		HTTPRequest(req, &http.Response{StatusCode: 200}).
+		Info("local")
+
+	out := buf.String()
+	for _, expected := range []string{`"labels": "a=1 b=2"`, `"operation": "importer/import-42 start"`, `"http": "GET http://example.com/ 200"`} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("output should contain %s, got: %s", expected, out)
+		}
+	}
+}
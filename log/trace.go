@@ -0,0 +1,110 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Keys of the fields linking stackdriver entries to cloud trace
+const (
+	TraceKey        = "logging.googleapis.com/trace"
+	SpanKey         = "logging.googleapis.com/spanId"
+	TraceSampledKey = "logging.googleapis.com/trace_sampled"
+)
+
+// Headers carrying the trace context of incoming requests
+const (
+	CloudTraceHeader  = "X-Cloud-Trace-Context"
+	TraceParentHeader = "traceparent"
+)
+
+var (
+	cloudTraceFormat  = regexp.MustCompile(`^([0-9a-fA-F]{32})(?:/([0-9]+))?(?:;o=([01]))?$`)
+	traceParentFormat = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+)
+
+// Trace identifies the trace and span an entry belongs to
+type Trace struct {
+	TraceID string
+	SpanID  string
+	Sampled bool
+}
+
+// ParseTrace extracts the trace from the traceparent or X-Cloud-Trace-Context header, preferring traceparent
+// Span ids are returned as 16 hex digits, as expected by stackdriver
+func ParseTrace(h http.Header) (Trace, bool) {
+	if trace, ok := parseTraceParent(h.Get(TraceParentHeader)); ok {
+		return trace, true
+	}
+	return parseCloudTrace(h.Get(CloudTraceHeader))
+}
+
+// parseTraceParent parses a W3C traceparent header as "version-trace-span-flags"
+func parseTraceParent(value string) (Trace, bool) {
+	m := traceParentFormat.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil || m[1] == "ff" || isZero(m[2]) || isZero(m[3]) {
+		return Trace{}, false
+	}
+	flags, _ := strconv.ParseUint(m[4], 16, 8)
+	return Trace{TraceID: m[2], SpanID: m[3], Sampled: flags&1 == 1}, true
+}
+
+// parseCloudTrace parses a X-Cloud-Trace-Context header as "TRACE/SPAN;o=SAMPLED" with a decimal span id
+func parseCloudTrace(value string) (Trace, bool) {
+	m := cloudTraceFormat.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil || isZero(m[1]) {
+		return Trace{}, false
+	}
+	trace := Trace{TraceID: strings.ToLower(m[1]), Sampled: m[3] == "1"}
+	if len(m[2]) > 0 {
+		span, err := strconv.ParseUint(m[2], 10, 64)
+		if err != nil {
+			return Trace{}, false
+		}
+		if span != 0 {
+			trace.SpanID = fmt.Sprintf("%016x", span)
+		}
+	}
+	return trace, true
+}
+
+func isZero(id string) bool {
+	return strings.Trim(id, "0") == ""
+}
+
+// WithTrace returns a context whose logger links all entries to the trace and span in projectID
+func WithTrace(ctx context.Context, projectID, traceID, spanID string) context.Context {
+	return WithLogger(ctx, From(ctx).WithTrace(projectID, Trace{TraceID: traceID, SpanID: spanID}))
+}
+
+// WithTraceFromRequest returns a context whose logger links all entries to the trace of r in projectID
+// If r carries no valid trace header, ctx is returned unchanged
+func WithTraceFromRequest(ctx context.Context, projectID string, r *http.Request) context.Context {
+	trace, ok := ParseTrace(r.Header)
+	if !ok {
+		return ctx
+	}
+	return WithLogger(ctx, From(ctx).WithTrace(projectID, trace))
+}
+
+// WithTrace returns a new logger adding the trace fields to all entries
+// The fields are only added in stackdriver mode, local loggers are returned unchanged
+func (l *Logger) WithTrace(projectID string, trace Trace) *Logger {
+	if l.nop || l.local || len(trace.TraceID) == 0 {
+		return l
+	}
+	fields := []zap.Field{zap.String(TraceKey, fmt.Sprintf("projects/%s/traces/%s", projectID, trace.TraceID))}
+	if len(trace.SpanID) > 0 {
+		fields = append(fields, zap.String(SpanKey, trace.SpanID))
+	}
+	if trace.Sampled {
+		fields = append(fields, zap.Bool(TraceSampledKey, true))
+	}
+	return l.WithFields(fields...)
+}
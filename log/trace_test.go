@@ -0,0 +1,106 @@
+package log_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/seibert-media/golibs/log"
+)
+
+func Test_ParseTrace(t *testing.T) {
+	tests := map[string]struct {
+		header http.Header
+		trace  log.Trace
+		ok     bool
+	}{
+		"CloudTrace": {
+			header: http.Header{"X-Cloud-Trace-Context": {"105445aa7843bc8bf206b12000100000/1;o=1"}},
+			trace:  log.Trace{TraceID: "105445aa7843bc8bf206b12000100000", SpanID: "0000000000000001", Sampled: true},
+			ok:     true,
+		},
+		"CloudTraceWithoutSpan": {
+			header: http.Header{"X-Cloud-Trace-Context": {"105445AA7843BC8BF206B12000100000"}},
+			trace:  log.Trace{TraceID: "105445aa7843bc8bf206b12000100000"},
+			ok:     true,
+		},
+		"TraceParent": {
+			header: http.Header{"Traceparent": {"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}},
+			trace:  log.Trace{TraceID: "0af7651916cd43dd8448eb211c80319c", SpanID: "b7ad6b7169203331", Sampled: true},
+			ok:     true,
+		},
+		"TraceParentPreferred": {
+			header: http.Header{
+				"Traceparent":           {"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00"},
+				"X-Cloud-Trace-Context": {"105445aa7843bc8bf206b12000100000/1;o=1"},
+			},
+			trace: log.Trace{TraceID: "0af7651916cd43dd8448eb211c80319c", SpanID: "b7ad6b7169203331"},
+			ok:    true,
+		},
+		"InvalidTraceParent": {
+			header: http.Header{"Traceparent": {"00-00000000000000000000000000000000-b7ad6b7169203331-01"}},
+		},
+		"InvalidCloudTrace": {
+			header: http.Header{"X-Cloud-Trace-Context": {"trace/span"}},
+		},
+		"Missing": {
+			header: http.Header{},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			trace, ok := log.ParseTrace(test.header)
+			if ok != test.ok || trace != test.trace {
+				t.Fatal("unexpected trace:", trace, ok)
+			}
+		})
+	}
+}
+
+func Test_WithTrace(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger, err := log.NewWithOptions(log.OptOutput(buf))
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Cloud-Trace-Context", "105445aa7843bc8bf206b12000100000/1;o=1")
+	log.From(log.WithTraceFromRequest(logger.To(context.Background()), "project", req)).Info("request")
+	log.From(log.WithTrace(logger.To(context.Background()), "project", "0af7651916cd43dd8448eb211c80319c", "")).Info("job")
+
+	dec := json.NewDecoder(buf)
+	var entry map[string]interface{}
+	if err := dec.Decode(&entry); err != nil {
+		t.Fatal("decoding entry failed with:", err)
+	}
+	if entry[log.TraceKey] != "projects/project/traces/105445aa7843bc8bf206b12000100000" ||
+		entry[log.SpanKey] != "0000000000000001" || entry[log.TraceSampledKey] != true {
+		t.Fatal("trace fields missing, got:", entry)
+	}
+	entry = nil
+	if err := dec.Decode(&entry); err != nil {
+		t.Fatal("decoding entry failed with:", err)
+	}
+	if entry[log.TraceKey] != "projects/project/traces/0af7651916cd43dd8448eb211c80319c" {
+		t.Fatal("trace field missing, got:", entry)
+	}
+	if _, ok := entry[log.SpanKey]; ok {
+		t.Fatal("empty span should be omitted, got:", entry)
+	}
+}
+
+func Test_WithTraceLocal(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger, err := log.NewWithOptions(log.OptLocal(true), log.OptOutput(buf))
+	if err != nil {
+		t.Fatal("creating logger failed with:", err)
+	}
+	if logger.WithTrace("project", log.Trace{TraceID: "0af7651916cd43dd8448eb211c80319c"}) != logger {
+		t.Fatal("local logger should be returned unchanged")
+	}
+}
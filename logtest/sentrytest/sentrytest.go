@@ -0,0 +1,320 @@
+// Package sentrytest provides an in-process sentry server to test error reporting offline
+package sentrytest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getsentry/raven-go"
+	"github.com/pkg/errors"
+)
+
+// Default credentials of the server DSN
+const (
+	PublicKey = "public"
+	ProjectID = "1"
+)
+
+// Event is a packet received by the Server
+type Event struct {
+	EventID     string                 `json:"event_id"`
+	Project     string                 `json:"project"`
+	Message     string                 `json:"message"`
+	Level       raven.Severity         `json:"level"`
+	Logger      string                 `json:"logger"`
+	Platform    string                 `json:"platform"`
+	Culprit     string                 `json:"culprit"`
+	ServerName  string                 `json:"server_name"`
+	Release     string                 `json:"release"`
+	Environment string                 `json:"environment"`
+	Tags        raven.Tags             `json:"tags"`
+	Extra       map[string]interface{} `json:"extra"`
+	Fingerprint []string               `json:"fingerprint"`
+	User        *raven.User            `json:"user"`
+	Request     *raven.Http            `json:"request"`
+
+	// Raw holds all top level keys of the packet, including interfaces not decoded above
+	Raw map[string]json.RawMessage `json:"-"`
+}
+
+// Tag returns the value of the tag with key
+func (e *Event) Tag(key string) (string, bool) {
+	for _, tag := range e.Tags {
+		if tag.Key == key {
+			return tag.Value, true
+		}
+	}
+	return "", false
+}
+
+// Interface decodes the packet interface with name, e.g. "exception" or "breadcrumbs", into v
+func (e *Event) Interface(name string, v interface{}) error {
+	raw, ok := e.Raw[name]
+	if !ok {
+		return errors.Errorf("event has no %s interface", name)
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// Server is a fake sentry server accepting events on the store and envelope endpoints
+type Server struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	events   []*Event
+	notify   chan struct{}
+	status   int
+	attempts int
+}
+
+// NewServer starts a Server, it has to be closed after use
+func NewServer() *Server {
+	s := &Server{notify: make(chan struct{})}
+	s.server = httptest.NewServer(s)
+	return s
+}
+
+// DSN to configure the client with
+func (s *Server) DSN() string {
+	return strings.Replace(s.server.URL, "://", "://"+PublicKey+"@", 1) + "/" + ProjectID
+}
+
+// URL of the server
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// Close shuts down the server
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Events returns all events received so far
+func (s *Server) Events() []*Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Event(nil), s.events...)
+}
+
+// Reset removes all received events
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = nil
+}
+
+// Fail makes the server reject all requests with status, 0 or http.StatusOK accepts them again
+func (s *Server) Fail(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+// Attempts returns the number of requests to the store endpoint, including rejected ones
+func (s *Server) Attempts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts
+}
+
+// WaitForEvents blocks until at least n events got received and returns them
+// An error is returned if they are not received within timeout
+func (s *Server) WaitForEvents(n int, timeout time.Duration) ([]*Event, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		s.mu.Lock()
+		events := append([]*Event(nil), s.events...)
+		notify := s.notify
+		s.mu.Unlock()
+
+		if len(events) >= n {
+			return events, nil
+		}
+
+		select {
+		case <-notify:
+		case <-deadline.C:
+			return events, errors.Errorf("received %d of %d events within %s", len(events), n, timeout)
+		}
+	}
+}
+
+// AssertEvent fails t unless an event with message and level got received within a second
+func (s *Server) AssertEvent(t testing.TB, message string, level raven.Severity) *Event {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		events := s.Events()
+		for _, event := range events {
+			if event.Message == message && event.Level == level {
+				return event
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no event %q at level %s received, got: %s", message, level, describe(events))
+			return nil
+		}
+		s.WaitForEvents(len(events)+1, time.Until(deadline))
+	}
+}
+
+// ServeHTTP implements http.Handler for the store and envelope endpoints
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var decode func(*http.Request) ([]*Event, error)
+	switch r.URL.Path {
+	case "/api/" + ProjectID + "/store/":
+		decode = decodeStore
+	case "/api/" + ProjectID + "/envelope/":
+		decode = decodeEnvelope
+	}
+	if r.Method != http.MethodPost || decode == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if !strings.Contains(r.Header.Get("X-Sentry-Auth"), "sentry_key="+PublicKey) {
+		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	s.mu.Lock()
+	s.attempts++
+	status := s.status
+	s.mu.Unlock()
+	if status != 0 && status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	events, err := decode(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.events = append(s.events, events...)
+	close(s.notify)
+	s.notify = make(chan struct{})
+	s.mu.Unlock()
+
+	var id string
+	if len(events) > 0 {
+		id = events[0].EventID
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"id":%q}`, id)
+}
+
+// decodeStore decodes the packet, which is zlib compressed and base64 encoded if sent as application/octet-stream
+func decodeStore(r *http.Request) ([]*Event, error) {
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Type") == "application/octet-stream" {
+		z, err := zlib.NewReader(base64.NewDecoder(base64.StdEncoding, r.Body))
+		if err != nil {
+			return nil, errors.Wrap(err, "decompressing packet")
+		}
+		defer z.Close()
+		body = z
+	}
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading packet")
+	}
+	event, err := decodeEvent(data)
+	if err != nil {
+		return nil, err
+	}
+	return []*Event{event}, nil
+}
+
+// decodeEnvelope decodes all event items of the envelope
+func decodeEnvelope(r *http.Request) ([]*Event, error) {
+	body := bufio.NewReader(r.Body)
+
+	// the envelope header is not needed
+	if _, err := body.ReadBytes('\n'); err != nil {
+		return nil, errors.Wrap(err, "reading envelope header")
+	}
+
+	var events []*Event
+	for {
+		line, err := body.ReadBytes('\n')
+		if err == io.EOF && len(bytes.TrimSpace(line)) == 0 {
+			return events, nil
+		}
+		if err != nil && err != io.EOF {
+			return nil, errors.Wrap(err, "reading item header")
+		}
+
+		var header struct {
+			Type   string `json:"type"`
+			Length *int   `json:"length"`
+		}
+		if err := json.Unmarshal(line, &header); err != nil {
+			return nil, errors.Wrap(err, "decoding item header")
+		}
+
+		var payload []byte
+		if header.Length != nil {
+			payload = make([]byte, *header.Length)
+			if _, err := io.ReadFull(body, payload); err != nil {
+				return nil, errors.Wrap(err, "reading item")
+			}
+			body.ReadByte()
+		} else {
+			payload, err = body.ReadBytes('\n')
+			if err != nil && err != io.EOF {
+				return nil, errors.Wrap(err, "reading item")
+			}
+		}
+
+		if header.Type != "event" {
+			continue
+		}
+		event, err := decodeEvent(payload)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+}
+
+func decodeEvent(data []byte) (*Event, error) {
+	var event Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, errors.Wrap(err, "decoding packet")
+	}
+	if err := json.Unmarshal(data, &event.Raw); err != nil {
+		return nil, errors.Wrap(err, "decoding packet")
+	}
+	return &event, nil
+}
+
+func describe(events []*Event) string {
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	for i, event := range events {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(&buf, "%q (%s)", event.Message, event.Level)
+	}
+	buf.WriteString("]")
+	return buf.String()
+}
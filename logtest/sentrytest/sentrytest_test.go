@@ -0,0 +1,147 @@
+package sentrytest_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getsentry/raven-go"
+	"github.com/seibert-media/golibs/logtest/sentrytest"
+)
+
+func newClient(t *testing.T, server *sentrytest.Server) *raven.Client {
+	client, err := raven.New(server.DSN())
+	if err != nil {
+		t.Fatal("creating client failed with:", err)
+	}
+	return client
+}
+
+func Test_Server(t *testing.T) {
+	server := sentrytest.NewServer()
+	defer server.Close()
+	client := newClient(t, server)
+
+	packet := raven.NewPacket("test", &raven.User{ID: "1"})
+	packet.Level = raven.ERROR
+	packet.Release = "v1"
+	packet.AddTags(map[string]string{"key": "value"})
+	if _, errCh := client.Capture(packet, nil); <-errCh != nil {
+		t.Fatal("sending failed")
+	}
+
+	event := server.AssertEvent(t, "test", raven.ERROR)
+	if event.Release != "v1" || event.User == nil || event.User.ID != "1" {
+		t.Fatal("event not decoded, got:", event)
+	}
+	if value, ok := event.Tag("key"); !ok || value != "value" {
+		t.Fatal("tag not decoded, got:", event.Tags)
+	}
+	var user raven.User
+	if err := event.Interface("user", &user); err != nil || user.ID != "1" {
+		t.Fatal("interface not decoded, got:", user, err)
+	}
+}
+
+func Test_ServerCompressed(t *testing.T) {
+	server := sentrytest.NewServer()
+	defer server.Close()
+	client := newClient(t, server)
+
+	message := strings.Repeat("large ", 500)
+	client.CaptureMessage(message, nil)
+
+	events, err := server.WaitForEvents(1, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events[0].Message != message {
+		t.Fatal("compressed packet not decoded, got:", events[0].Message)
+	}
+}
+
+func Test_ServerWaitForEvents(t *testing.T) {
+	server := sentrytest.NewServer()
+	defer server.Close()
+	client := newClient(t, server)
+
+	if _, err := server.WaitForEvents(1, 10*time.Millisecond); err == nil {
+		t.Fatal("waiting should time out without events")
+	}
+
+	go func() {
+		client.CaptureMessage("first", nil)
+		client.CaptureMessage("second", nil)
+	}()
+	events, err := server.WaitForEvents(2, time.Second)
+	if err != nil || len(events) != 2 {
+		t.Fatal("two events should be received, got:", len(events), err)
+	}
+
+	server.Reset()
+	if len(server.Events()) != 0 {
+		t.Fatal("events should be removed")
+	}
+}
+
+func Test_ServerCredentials(t *testing.T) {
+	server := sentrytest.NewServer()
+	defer server.Close()
+
+	client, err := raven.New(strings.Replace(server.DSN(), sentrytest.PublicKey, "invalid", 1))
+	if err != nil {
+		t.Fatal("creating client failed with:", err)
+	}
+	if _, errCh := client.Capture(raven.NewPacket("test"), nil); <-errCh == nil {
+		t.Fatal("sending with invalid credentials should fail")
+	}
+	if len(server.Events()) != 0 {
+		t.Fatal("event should be rejected")
+	}
+}
+
+func Test_ServerFail(t *testing.T) {
+	server := sentrytest.NewServer()
+	defer server.Close()
+	client := newClient(t, server)
+
+	server.Fail(http.StatusServiceUnavailable)
+	if _, errCh := client.Capture(raven.NewPacket("rejected"), nil); <-errCh == nil {
+		t.Fatal("sending should fail")
+	}
+	server.Fail(0)
+	if _, errCh := client.Capture(raven.NewPacket("accepted"), nil); <-errCh != nil {
+		t.Fatal("sending should succeed")
+	}
+
+	if server.Attempts() != 2 || len(server.Events()) != 1 {
+		t.Fatal("only the accepted event should be recorded, got:", server.Attempts(), len(server.Events()))
+	}
+}
+
+func Test_ServerEnvelope(t *testing.T) {
+	server := sentrytest.NewServer()
+	defer server.Close()
+
+	body := `{"event_id":"1"}` + "\n" +
+		`{"type":"attachment","length":4}` + "\n" + "data" + "\n" +
+		`{"type":"event","length":45}` + "\n" + `{"event_id":"1","message":"a","level":"info"}` + "\n" +
+		`{"type":"event"}` + "\n" + `{"event_id":"2","message":"b","level":"info"}` + "\n"
+	req, _ := http.NewRequest(http.MethodPost, server.URL()+"/api/"+sentrytest.ProjectID+"/envelope/", strings.NewReader(body))
+	req.Header.Set("X-Sentry-Auth", "Sentry sentry_version=7, sentry_key="+sentrytest.PublicKey)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("sending failed with:", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatal("envelope should be accepted, got:", res.StatusCode)
+	}
+
+	server.AssertEvent(t, "a", raven.INFO)
+	server.AssertEvent(t, "b", raven.INFO)
+	if len(server.Events()) != 2 {
+		t.Fatal("only event items should be recorded, got:", len(server.Events()))
+	}
+}